@@ -2,8 +2,12 @@ package run
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 
 	"time"
@@ -26,6 +30,25 @@ type app struct{
 	dir string
 	// extracted command specific env
 	env []string
+	// complete process env used as is instead of combining Env, os env and env
+	environ []string
+	// standard streams of the process, os.Stdin, os.Stdout and os.Stderr if nil
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	// output writers to close once the process exited
+	closers []io.Closer
+	// secrets visible when the command was loaded, for logging from other goroutines
+	secrets []string
+	// hooks active when the command was loaded
+	hooks []Hooks
+	// proc describes the process for the hooks once launched
+	proc *Process
+	// started is closed once the pid of proc is set, the output writers wait for it
+	started chan struct{}
+	// tty runs the process under a pseudo-terminal
+	tty bool
+	// expect drives the process through its stdin, nil if not set
+	expect *expectSession
 
 }
 
@@ -42,55 +65,294 @@ type asyncApp struct{
 // getCmd returns exec.Cmd
 // binary names will be evaluated with Env here since this is the last step before Run()
 func (a *app) getCmd() (*exec.Cmd, error) {
-	path, err := exec.LookPath(a.bin)
-	if err != nil {
-		if path , err= exec.LookPath(os.Expand(a.bin, func(key string)string{
-			if v,ok:=(*Env)[key];ok{
-					return v
-			}else{
-				return ""
-			}
-		})); err!=nil{
-			return nil, fmt.Errorf("installing %v is in your future...", a.bin)
+	a.hooks, a.secrets, a.tty = activeHooks(), Env.secrets(), ttyMode
+	a.started = make(chan struct{})
+	env, bin := a.environ, a.bin
+	if env == nil {
+		scope, err := a.scope()
+		if err != nil {
+			return nil, err
 		}
+		if bin, err = expand(a.bin, scope); err != nil {
+			return nil, err
+		}
+		env = scope.List()
+	}
+	path, err := lookPath(bin, a.dir, env)
+	if err != nil {
+		return nil, fmt.Errorf("installing %v is in your future...", bin)
 	}
 	cmd := exec.Command(path, a.arg...)
 	if a.dir != "" {
 		cmd.Dir = a.dir
 	}
 
-	cmd.Env = Env.combine(append(a.env, os.Environ()...)).list()
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr 
-
+	// a nil Env would make the child inherit the whole process environment
+	cmd.Env = append([]string{}, env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = io.Reader(os.Stdin), io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if a.stdin != nil {
+		cmd.Stdin = a.stdin
+	}
+	if a.stdout != nil {
+		cmd.Stdout = a.stdout
+	}
+	if a.stderr != nil {
+		cmd.Stderr = a.stderr
+	}
+	a.wrapOutput(cmd)
+	if expectSteps != nil {
+		if err := a.expectInput(cmd); err != nil {
+			a.close()
+			return nil, err
+		}
+	}
 
-	if len(Env.list())>0  {
-		logger.Printf("Env: %s\n", Env)
+	if env := Env.String(); env != "" {
+		logger.Log(EventEnvResolved, "env", env)
 	}
-	logger.Printf("Command loaded: %s\n", a.cmd)
+	logger.Log(EventCommandLoaded, "cmd", a.redact(a.cmd), "path", path, "dir", a.dir)
 
 
 	return cmd, nil
 }
 
 
+// wrapOutput applies the output modes of the chain to the streams of cmd,
+// from the innermost: line prefixes, scrubbing secrets and hooks
+func (a *app) wrapOutput(cmd *exec.Cmd) {
+	wrap := func(stdout, stderr io.WriteCloser) {
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		// the outer writers are closed first, flushing their pending lines into the inner ones
+		a.closers = append([]io.Closer{stdout, stderr}, a.closers...)
+	}
+	if lineOutput != nil {
+		wrap(lineOutput.writers(a, cmd.Stdout, cmd.Stderr))
+	}
+	if secrets := a.secrets; scrubOutput && len(secrets) > 0 {
+		wrap(&scrubWriter{w: cmd.Stdout, secrets: secrets}, &scrubWriter{w: cmd.Stderr, secrets: secrets})
+	}
+	for _, h := range a.hooks {
+		if h.OnOutputLine != nil {
+			wrap(&lineWriter{w: cmd.Stdout, app: a, stream: Stdout}, &lineWriter{w: cmd.Stderr, app: a, stream: Stderr})
+			break
+		}
+	}
+}
+
+// expectInput replaces the stdin of cmd by the steps of Expect,
+// which see the raw output of both streams
+func (a *app) expectInput(cmd *exec.Cmd) error {
+	e, err := newExpectSession(expectSteps)
+	if err != nil {
+		return err
+	}
+	a.expect = e
+	cmd.Stdin = e.inRead
+	cmd.Stdout, cmd.Stderr = io.MultiWriter(cmd.Stdout, e), io.MultiWriter(cmd.Stderr, e)
+	// the output is complete once the writers of the app are closed
+	a.closers = append(a.closers, e)
+	return nil
+}
+
+// scope returns the env scope of the app: the process environment,
+// overridden by Env and then by the command specific env
+func (a *app) scope() (*EnvSet, error) {
+	env := Env.Layer(CommandLayer)
+	return env, env.Set(a.env...)
+}
+
+// lookCache caches binary lookups per PATH value
+var lookCache = struct {
+	sync.Mutex
+	paths map[string]map[string]string
+}{paths: make(map[string]map[string]string)}
+
+// lookPath resolves bin the way the child process would, against the PATH in env.
+// Relative paths, including relative PATH entries, are resolved against dir.
+func lookPath(bin, dir string, env []string) (string, error) {
+	if dir == "" || !filepath.IsAbs(dir) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(wd, dir)
+	}
+	if strings.ContainsAny(bin, `/\`) {
+		if !filepath.IsAbs(bin) {
+			bin = filepath.Join(dir, bin)
+		}
+		return exec.LookPath(bin)
+	}
+
+	var pathList string
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i > 0 && (kv[:i] == "PATH" || runtime.GOOS == "windows" && strings.EqualFold(kv[:i], "PATH")) {
+			pathList = kv[i+1:]
+		}
+	}
+	key := pathList
+	for _, p := range filepath.SplitList(pathList) {
+		if !filepath.IsAbs(p) {
+			// relative entries depend on the working directory as well
+			key = pathList + string(os.PathListSeparator) + dir
+			break
+		}
+	}
+
+	lookCache.Lock()
+	defer lookCache.Unlock()
+	cache, ok := lookCache.paths[key]
+	if !ok {
+		cache = make(map[string]string)
+		lookCache.paths[key] = cache
+	}
+	if path, ok := cache[bin]; ok {
+		return path, nil
+	}
+	for _, p := range filepath.SplitList(pathList) {
+		if p == "" {
+			p = "."
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if path, err := exec.LookPath(filepath.Join(p, bin)); err == nil {
+			cache[bin] = path
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: bin, Err: exec.ErrNotFound}
+}
+
+// redact replaces the secrets of the app in s
+func (a *app) redact(s string) string {
+	return replaceSecrets(s, a.secrets)
+}
+
+// launch runs the BeforeRun hooks and starts the process
+func (a *app) launch(cmd *exec.Cmd, async bool) error {
+	a.proc = a.process(cmd, async)
+	for _, h := range a.hooks {
+		if h.BeforeRun != nil {
+			if err := h.BeforeRun(a.proc); err != nil {
+				close(a.started)
+				return err
+			}
+		}
+	}
+	a.proc.Started = time.Now()
+	err := a.start(cmd)
+	if err == nil {
+		a.proc.Pid = cmd.Process.Pid
+	}
+	// the output may be copied from other goroutines before Start returned
+	close(a.started)
+	if err != nil {
+		return err
+	}
+	logger.Log(EventCommandStarted, "cmd", a.proc.Cmd, "pid", a.proc.Pid, "async", async)
+	for _, h := range a.hooks {
+		if h.AfterStart != nil {
+			h.AfterStart(a.proc)
+		}
+	}
+	return nil
+}
+
+// startedProc waits for the process to be started, for the output writers
+// which may get output before launch returned
+func (a *app) startedProc() *Process {
+	<-a.started
+	return a.proc
+}
+
+// start starts the process, under a pseudo-terminal in tty mode
+func (a *app) start(cmd *exec.Cmd) error {
+	start := cmd.Start
+	if a.tty {
+		start = func() error {
+			return a.startTty(cmd)
+		}
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	if a.expect != nil {
+		a.expect.begin(cmd.Process)
+	}
+	return nil
+}
+
+// finish logs and reports the end of the process, or the error preventing it to run
+func (a *app) finish(cmd *exec.Cmd, err error) {
+	if a.proc == nil {
+		a.proc = a.process(cmd, false)
+	}
+	var elapsed time.Duration
+	if !a.proc.Started.IsZero() {
+		elapsed = time.Since(a.proc.Started)
+	}
+	code := -1
+	if cmd != nil && cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	if cmd != nil {
+		fields := []interface{}{"cmd", a.proc.Cmd, "pid", a.proc.Pid, "code", code, "duration", elapsed}
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			fields = append(fields, "error", a.redact(err.Error()))
+		}
+		logger.Log(EventCommandExited, fields...)
+	}
+	for _, h := range a.hooks {
+		if h.OnExit != nil && cmd != nil && cmd.ProcessState != nil {
+			h.OnExit(a.proc, code, elapsed)
+		}
+		if h.OnError != nil && err != nil {
+			h.OnError(a.proc, &redactedError{err, a.secrets})
+		}
+	}
+}
+
+// close closes the output writers of the app, returning the first error
+func (a *app) close() (err error) {
+	for _, c := range a.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	a.closers = nil
+	return
+}
+
 func (sa *syncApp) Run() error{
 	if cmd, err:= sa.getCmd(); err!=nil{
-		return err
+		sa.finish(nil, err)
+		return redactError(err)
 	}else{
-		return cmd.Run()
+		if err = sa.launch(cmd, false); err == nil {
+			err = waitCmd(cmd.Wait)
+		}
+		if cerr := sa.close(); cerr != nil {
+			err = cerr
+		}
+		sa.finish(cmd, err)
+		return redactError(err)
 	}
 }
 
 
 func (aa *asyncApp) Run() error {
 	if cmd,err:= aa.getCmd(); err != nil {
-		return err
+		aa.finish(nil, err)
+		return redactError(err)
 	}else{
+		aa.Add(1)
 		go func(){
-			aa.Add(1)
 			defer aa.Done()
-			if err:= cmd.Start();err != nil {
-				aa.err = err
+			if err:= aa.launch(cmd, true);err != nil {
+				aa.close()
+				aa.finish(cmd, err)
+				aa.err = &redactedError{err, aa.secrets}
 			}else{
 				// cmd succefully started, record it with timestamps
 				if c, ok:= appMap[aa.cmd]; !ok{
@@ -101,8 +363,14 @@ func (aa *asyncApp) Run() error {
 					c[time.Now()] = cmd
 				}
 
-				logger.Println("Async application added [%q]\n", aa.cmd)
-				aa.err =  cmd.Wait()
+				err = cmd.Wait()
+				if cerr := aa.close(); cerr != nil {
+					err = cerr
+				}
+				aa.finish(cmd, err)
+				if err != nil {
+					aa.err = &redactedError{err, aa.secrets}
+				}
 			}
 		}()
 		return nil
@@ -129,7 +397,7 @@ func Stop(cmd string, spans ...[2]time.Time) error{
 				}
 			}
 			delete(cm, ts)
-			logger.Printf("Processes[%q:%v] killed\n", cmd, ts.Format(time.RFC850))
+			logger.Log(EventProcessKilled, "cmd", redact(cmd), "pid", c.Process.Pid, "started", ts)
 		}
 		
 	}else{
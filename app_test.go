@@ -0,0 +1,47 @@
+package run
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestLookPath(t *testing.T) {
+	wd, _ := os.Getwd()
+	hello := filepath.Join(wd, "test", "bin", "hello")
+
+	path, err := lookPath("./bin/hello", "test", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, hello, path, "Relative binary should be resolved against the working directory.")
+
+	path, err = lookPath("hello", "test", []string{"PATH=bin"})
+	assert.NoError(t, err)
+	assert.Equal(t, hello, path, "Relative PATH entries should be resolved against the working directory.")
+
+	_, err = lookPath("hello", "", []string{"PATH=bin"})
+	assert.Error(t, err, "Lookup should be cached per PATH and working directory.")
+
+	_, err = lookPath("hello", "", []string{"PATH=" + os.Getenv("PATH")})
+	assert.Error(t, err)
+}
+
+func TestLookPathRunnable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	Call("./hello").At("test/bin").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "hello", output.String(), "Binary should be looked up in the At directory.")
+
+	output.Reset()
+	Call("hello").With("PATH=./test/bin::$PATH").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "hello", output.String(), "Binary should be looked up in the PATH set by With.")
+
+	output.Reset()
+	Call("PATH=bin::$PATH hello").At("test").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "hello", output.String(), "Binary should be looked up in the PATH set by command prefix.")
+}
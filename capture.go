@@ -0,0 +1,136 @@
+package run
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envChange is a variable set or unset by a captured script
+type envChange struct {
+	key   string
+	val   string
+	unset bool
+}
+
+// capturedEnv collects the env changes of the shell scripts run by the current chain,
+// nil if the chain does not capture
+var capturedEnv *[]envChange
+
+// volatileEnv are maintained by the shells themselves and never captured
+var volatileEnv = []string{"_", "SHLVL", "PWD", "OLDPWD"}
+
+// recordEnv records the difference between Env, which the script started with,
+// and the environment the script ended with
+func recordEnv(environ []string) {
+	after := make(map[string]bool)
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 || isVolatileEnv(kv[:i]) {
+			continue
+		}
+		key, val := kv[:i], kv[i+1:]
+		after[key] = true
+		if v, ok := Env.Lookup(key); !ok || v != val {
+			*capturedEnv = append(*capturedEnv, envChange{key: key, val: val})
+		}
+	}
+	for _, key := range Env.Keys() {
+		if !after[key] && !isVolatileEnv(key) {
+			*capturedEnv = append(*capturedEnv, envChange{key: key, unset: true})
+		}
+	}
+}
+
+func isVolatileEnv(key string) bool {
+	for _, k := range volatileEnv {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpEnv returns a temporary file and the script prefix making the shell
+// write its environment there on exit, even if the script fails or calls exit
+func dumpEnv() (*os.File, string, error) {
+	f, err := ioutil.TempFile("", "run-env")
+	if err != nil {
+		return nil, "", err
+	}
+	// the trap shares the line of the script, keeping its line numbers
+	return f, "trap " + shellQuote("env -0 > "+shellQuote(f.Name())) + " EXIT; ", nil
+}
+
+// exitTrap matches a trap command setting or resetting the EXIT trap
+var exitTrap = regexp.MustCompile(`(^|[\s;&|(])trap\s[^\n]*\s(EXIT|0)(\s|;|$)`)
+
+// loadDump records the environment written to the dump file by the script
+func loadDump(f *os.File, script string) error {
+	src, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(src) == 0 {
+		if exitTrap.MatchString(script) {
+			return fmt.Errorf("Shell environment was not captured, the EXIT trap of the script replaced the one writing it")
+		}
+		return fmt.Errorf("Shell environment was not captured, the script may have replaced the shell with exec")
+	}
+	recordEnv(strings.Split(strings.TrimSuffix(string(src), "\x00"), "\x00"))
+	return nil
+}
+
+// runCaptured runs the app whose script starts with the prefix returned by dumpEnv
+// and records the resulting environment. The script source is only used to explain a missing dump.
+func runCaptured(a app, f *os.File, script string) error {
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := (&syncApp{a}).Run(); err != nil {
+		return err
+	}
+	return loadDump(f, script)
+}
+
+// captureScope returns the scope the captured changes are merged into by default:
+// Env without the layers of With, WithSecret and WithEnvFile, which only last for their chain
+func captureScope() *EnvSet {
+	e := Env
+	for e.layer == WithLayer && e.parent != nil {
+		e = e.parent
+	}
+	return e
+}
+
+func captureEnv(into []*EnvSet, run Runnable) Runnable {
+	return runner(func() error {
+		if len(into) > 1 {
+			return fmt.Errorf("CaptureEnv takes at most one env set!")
+		}
+		dst := captureScope()
+		if len(into) == 1 {
+			dst = into[0]
+		}
+		old := capturedEnv
+		defer func() {
+			capturedEnv = old
+		}()
+		var changes []envChange
+		capturedEnv = &changes
+		if run != nil {
+			if err := run.Run(); err != nil {
+				return err
+			}
+		}
+		for _, c := range changes {
+			if c.unset {
+				dst.Unset(c.key)
+			} else {
+				dst.put(c.key, c.val)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package run
+
+import (
+	"bytes"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestCaptureEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := exec.Command("sh", "-c", "env -0 >/dev/null").Run(); err != nil {
+		t.Skip("env -0 is not supported")
+	}
+	defer func() {
+		Env = newGlobalEnv()
+	}()
+	Env = newGlobalEnv("RUN_DEACTIVATE=1")
+
+	err := Shell(`export RUN_CAPTURED="a b"; RUN_LOCAL=1; unset RUN_DEACTIVATE; cd test`).CaptureEnv().Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "a b", Env.Get("RUN_CAPTURED"), "Exported variables should be captured")
+	assert.Equal(t, "", Env.Get("RUN_LOCAL"), "Shell variables should not be captured")
+	_, ok := Env.Lookup("RUN_DEACTIVATE")
+	assert.False(t, ok, "Unset variables should be captured")
+	assert.NotEqual(t, GlobalLayer, Env.Explain("PWD"), "Variables of the shell should not be captured")
+
+	var output bytes.Buffer
+	Shell(`echo -n $RUN_CAPTURED`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "a b", output.String(), "Captured variables should be passed to later commands")
+
+	env, _ := NewEnv()
+	err = Script("activate.sh").At("test").With("RUN_DEACTIVATE=0").CaptureEnv(env).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, env.Len(), "Diff should be relative to the script env")
+	assert.Equal(t, "yes", env.Get("ACTIVATED"))
+	assert.Equal(t, "/opt/run-sdk/bin", env.PathList("PATH")[0])
+	assert.Equal(t, "", Env.Get("ACTIVATED"))
+
+	err = Shell(`export RUN_FAILED=1; exit 2`).CaptureEnv().Run()
+	assert.Error(t, err)
+	assert.Equal(t, "", Env.Get("RUN_FAILED"), "Failed scripts should not change the env")
+
+	assert.Error(t, Shell(`exec true`).CaptureEnv().Run(), "Replaced shells cannot be captured")
+
+	err = Shell(`trap 'echo bye' EXIT; export RUN_TRAPPED=1`).CaptureEnv().Run()
+	if assert.Error(t, err, "Scripts replacing the EXIT trap cannot be captured") {
+		assert.True(t, strings.Contains(err.Error(), "EXIT trap"), err.Error())
+	}
+
+	err = Shell(`export RUN_WITH=$RUN_OUTER`).CaptureEnv().With("RUN_OUTER=outer").Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "outer", Env.Get("RUN_WITH"), "Variables should be captured below the With layers of the chain")
+	assert.Equal(t, GlobalLayer, Env.Explain("RUN_WITH"))
+	assert.Equal(t, "", Env.Get("RUN_OUTER"))
+}
+
+func TestCaptureEnvBuiltin(t *testing.T) {
+	env, _ := NewEnv()
+	err := Shell(BuiltinShell, `export RUN_CAPTURED=builtin; RUN_LOCAL=1`).CaptureEnv(env).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RUN_CAPTURED=builtin"}, env.List())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	run "github.com/Fiery/go-run"
+)
+
+// register registers all tasks of the file with run.Task.
+// The args are appended to the call and start commands of the named tasks
+// and passed as positional parameters to their shell commands.
+func (f *taskFile) register(args []string, named ...string) {
+	for _, name := range f.names() {
+		var a []string
+		for _, n := range named {
+			if n == name {
+				a = args
+			}
+		}
+		run.Task(name, f.Tasks[name].Deps, f.runnable(f.Tasks[name], a))
+	}
+}
+
+// runnable chains the commands of the task with its env and directory,
+// it returns nil for tasks without commands
+func (f *taskFile) runnable(t *task, args []string) run.Runnable {
+	var r run.Runnable
+	for _, c := range t.Cmds {
+		r = c.chain(r, args)
+	}
+	if r == nil {
+		return nil
+	}
+	if len(t.Sources) > 0 {
+		r = r.Sources(t.Sources...)
+	}
+	if len(t.Targets) > 0 {
+		r = r.Targets(t.Targets...)
+	}
+	if env := append(append([]string(nil), f.Env...), t.Env...); len(env) > 0 {
+		r = r.With(env...)
+	}
+	// later files override the earlier ones, so they are the inner layers
+	for i := len(f.Dotenv) - 1; i >= 0; i-- {
+		r = r.WithEnvFile(f.Dotenv[i])
+	}
+	if t.Dir != "" {
+		r = r.At(t.Dir)
+	}
+	return r
+}
+
+// chain appends the command to r, or returns the command alone if r is nil
+func (c command) chain(r run.Runnable, args []string) run.Runnable {
+	switch {
+	case c.Parallel != nil:
+		group := make([]run.Runnable, len(c.Parallel))
+		for i, p := range c.Parallel {
+			group[i] = p.chain(nil, args)
+		}
+		if r == nil {
+			return run.Parallel(group...)
+		}
+		return r.Parallel(group...)
+	case c.Shell != "":
+		script := c.Shell
+		if len(args) > 0 {
+			// the positional parameters are set by the script itself, for this command only,
+			// on its first line to keep its line numbers
+			script = "set --" + quoteArgs(args) + "; " + script
+		}
+		if r == nil {
+			return run.Shell(script)
+		}
+		return r.Shell(script)
+	case c.Start != "":
+		if r == nil {
+			return run.Start(appendArgs(c.Start, args))
+		}
+		return r.Start(appendArgs(c.Start, args))
+	}
+	if r == nil {
+		return run.Call(appendArgs(c.Call, args))
+	}
+	return r.Call(appendArgs(c.Call, args))
+}
+
+// quoteArgs returns the args as single quoted shell words, each preceded by a space
+func quoteArgs(args []string) string {
+	var b strings.Builder
+	for _, a := range args {
+		b.WriteString(" '" + strings.Replace(a, "'", `'\''`, -1) + "'")
+	}
+	return b.String()
+}
+
+// appendArgs appends args to the command line, quoting those with spaces
+func appendArgs(line string, args []string) string {
+	for _, a := range args {
+		if strings.ContainsAny(a, " \t\"'") {
+			a = strconv.Quote(a)
+		}
+		line += " " + a
+	}
+	return line
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	run "github.com/Fiery/go-run"
+	"github.com/Fiery/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "log")
+
+	f, err := parseTaskFile(t, `
+env: [LOG=`+log+`, NAME=global]
+tasks:
+  a:
+    deps: [b, c]
+    env: [NAME=a]
+    cmds:
+      - shell: echo "$NAME $*" >> $LOG
+  b:
+    deps: [c]
+    cmds:
+      - shell: echo "$NAME" >> $LOG
+  c:
+    dir: `+dir+`
+    cmds:
+      - parallel:
+          - shell: sleep 0.1; echo p1 >> $LOG
+          - shell: echo p2 >> $LOG
+      - touch c.out
+  gen:
+    dir: `+dir+`
+    sources: [c.out]
+    targets: [gen.out]
+    cmds:
+      - shell: echo gen >> $LOG; touch gen.out
+  fail:
+    cmds:
+      - shell: exit 3
+      - touch never
+`)
+	assert.NoError(t, err)
+
+	f.register([]string{"x", "y z", "it's"}, "a")
+	assert.NoError(t, run.Do("a"))
+	out, _ := ioutil.ReadFile(log)
+	assert.Equal(t, "p2\np1\nglobal\na x y z it's\n", string(out), "Dependencies should run once, in order")
+	_, err = os.Stat(filepath.Join(dir, "c.out"))
+	assert.NoError(t, err, "Commands should run in the directory of the task")
+
+	os.Remove(log)
+	assert.NoError(t, run.Do("gen"))
+	assert.NoError(t, run.Do("gen"))
+	out, _ = ioutil.ReadFile(log)
+	assert.Equal(t, "gen\n", string(out), "Up to date targets should skip the task")
+
+	assert.Error(t, run.Do("fail"))
+	_, err = os.Stat("never")
+	assert.True(t, os.IsNotExist(err), "Failing commands should stop the task")
+	assert.Error(t, run.Do("unknown"))
+}
+
+func TestRegisterCycle(t *testing.T) {
+	f, err := parseTaskFile(t, "tasks:\n  a:\n    deps: [b]\n  b:\n    deps: [c]\n  c:\n    deps: [a]\n  d:\n    deps: [e]\n")
+	assert.NoError(t, err)
+	f.register(nil)
+	err = run.Do("a")
+	if assert.Error(t, err) {
+		assert.Equal(t, "task dependency cycle: a -> b -> c -> a", err.Error())
+	}
+	assert.Error(t, run.Do("d"), "Unknown dependencies should be reported")
+}
+
+func TestQuoteArgs(t *testing.T) {
+	assert.Equal(t, "", quoteArgs(nil))
+	assert.Equal(t, ` 'a b' 'it'\''s' '$x'`, quoteArgs([]string{"a b", "it's", "$x"}))
+}
+
+func TestAppendArgs(t *testing.T) {
+	assert.Equal(t, "go test", appendArgs("go test", nil))
+	assert.Equal(t, `go test -run "Test A" ./...`, appendArgs("go test", []string{"-run", "Test A", "./..."}))
+}
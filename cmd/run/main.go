@@ -0,0 +1,103 @@
+// Command run runs the tasks of a YAML task file with go-run.
+//
+//	run [-f file] [-v] [task...] [-- args...]
+//	run --list
+//
+// Without task the "default" task is run. Arguments after "--" are
+// appended to the call and start commands of the given tasks and passed
+// as positional parameters to their shell commands. A task file looks like
+//
+//	env:
+//	  - CGO_ENABLED=0
+//	dotenv:
+//	  - .env
+//	tasks:
+//	  default:
+//	    deps: [build]
+//	  generate:
+//	    cmds:
+//	      - go generate ./...
+//	  build:
+//	    desc: Build and vet all packages
+//	    deps: [generate]
+//	    env: [GOFLAGS=-trimpath]
+//	    cmds:
+//	      - parallel:
+//	          - go build ./...
+//	          - go vet ./...
+//	  serve:
+//	    dir: ./web
+//	    cmds:
+//	      - start: ./server --port 8080
+//	      - shell: echo "serving $1" && wait
+//
+// Commands given as plain strings are run with run.Call, the mapping forms
+// call, shell, start and parallel select the Runnable explicitly.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/tabwriter"
+
+	run "github.com/Fiery/go-run"
+	flag "github.com/Fiery/pflag"
+)
+
+func main() {
+	path := flag.StringP("file", "f", "", "task file, run.yml or run.yaml in the working directory by default")
+	list := flag.BoolP("list", "l", false, "list the tasks and exit")
+	verbose := flag.BoolP("verbose", "v", false, "log the events of go-run to stderr")
+	flag.Parse()
+	if *verbose {
+		run.SetLogger(run.NewTextLogger(os.Stderr))
+	}
+
+	if err := runTasks(*path, *list); err != nil {
+		fmt.Fprintln(os.Stderr, "run:", err)
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && exit.ExitCode() > 0 {
+			os.Exit(exit.ExitCode())
+		}
+		os.Exit(1)
+	}
+}
+
+func runTasks(path string, list bool) error {
+	path, err := findTaskFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := loadTaskFile(path)
+	if err != nil {
+		return err
+	}
+	if list {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, name := range f.names() {
+			fmt.Fprintf(w, "%s\t%s\n", name, f.Tasks[name].Desc)
+		}
+		return w.Flush()
+	}
+
+	// paths in the task file are relative to it
+	if err = os.Chdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	names, args := flag.Args(), []string(nil)
+	if n := flag.CommandLine.ArgsLenAtDash(); n >= 0 {
+		names, args = names[:n], names[n:]
+	}
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+	f.register(args, names...)
+	if err = run.Do(names...); err != nil {
+		return err
+	}
+	run.Wait()
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFiles are the task files looked up in the working directory
+var DefaultFiles = []string{"run.yml", "run.yaml"}
+
+// taskFile is the content of a task file
+type taskFile struct {
+	// Env is set for all tasks, before the env of the task
+	Env []string `yaml:"env"`
+	// Dotenv files are loaded for all tasks, before Env
+	Dotenv []string         `yaml:"dotenv"`
+	Tasks  map[string]*task `yaml:"tasks"`
+}
+
+// task is a named list of commands
+type task struct {
+	Desc string `yaml:"desc"`
+	// Deps are run once before the commands, independent ones at the same time
+	Deps []string `yaml:"deps"`
+	// Dir is the working directory of the commands, relative to the task file
+	Dir  string    `yaml:"dir"`
+	Env  []string  `yaml:"env"`
+	Cmds []command `yaml:"cmds"`
+	// Sources and Targets skip the commands if the targets are up to date, see run.Runnable.Sources
+	Sources []string `yaml:"sources"`
+	Targets []string `yaml:"targets"`
+}
+
+// command is an entry of task.Cmds, a plain string is run with run.Call
+type command struct {
+	Call  string `yaml:"call"`
+	Shell string `yaml:"shell"`
+	Start string `yaml:"start"`
+	// Parallel runs the commands of the group at the same time
+	Parallel []command `yaml:"parallel"`
+}
+
+// UnmarshalYAML accepts a plain command line or a mapping with exactly one field
+func (c *command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Call)
+	}
+	type plain command
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	set := 0
+	for _, ok := range []bool{c.Call != "", c.Shell != "", c.Start != "", c.Parallel != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("line %d: command needs exactly one of call, shell, start or parallel", node.Line)
+	}
+	return nil
+}
+
+// findTaskFile returns path, or the first of DefaultFiles existing if path is empty
+func findTaskFile(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	for _, p := range DefaultFiles {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no task file found, looked for %v", DefaultFiles)
+}
+
+// loadTaskFile reads and validates the task file at path
+func loadTaskFile(path string) (*taskFile, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &taskFile{}
+	if err = yaml.Unmarshal(src, f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, t := range f.Tasks {
+		if t == nil {
+			f.Tasks[name] = &task{}
+		}
+	}
+	return f, nil
+}
+
+// names returns the task names in alphabetical order
+func (f *taskFile) names() (names []string) {
+	for name := range f.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
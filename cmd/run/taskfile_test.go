@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func parseTaskFile(t *testing.T, src string) (*taskFile, error) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+	return loadTaskFile(path)
+}
+
+func TestLoadTaskFile(t *testing.T) {
+	f, err := parseTaskFile(t, `
+env: [FOO=foo]
+tasks:
+  build:
+    desc: Build it
+    deps: [gen]
+    dir: ./src
+    env: [BAR=bar]
+    cmds:
+      - go build ./...
+      - shell: echo $1
+      - start: ./server
+      - parallel:
+          - go vet ./...
+          - call: golint
+  gen:
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FOO=foo"}, f.Env)
+	assert.Equal(t, []string{"build", "gen"}, f.names())
+
+	build := f.Tasks["build"]
+	assert.Equal(t, "Build it", build.Desc)
+	assert.Equal(t, []string{"gen"}, build.Deps)
+	assert.Equal(t, "./src", build.Dir)
+	assert.Equal(t, []command{
+		{Call: "go build ./..."},
+		{Shell: "echo $1"},
+		{Start: "./server"},
+		{Parallel: []command{{Call: "go vet ./..."}, {Call: "golint"}}},
+	}, build.Cmds)
+	assert.NotNil(t, f.Tasks["gen"], "Empty tasks should be allowed")
+}
+
+func TestTaskFileErrors(t *testing.T) {
+	var c command
+	assert.Error(t, yaml.Unmarshal([]byte(`{call: a, shell: b}`), &c), "Commands should have one kind only")
+	assert.Error(t, yaml.Unmarshal([]byte(`{dir: a}`), &c))
+
+	_, err := findTaskFile("")
+	assert.Error(t, err, "No default task file in this directory")
+}
@@ -0,0 +1,180 @@
+package run
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Load reads dotenv files into e, in order. Later files and entries override earlier ones.
+//
+// Each line holds a `KEY=value` assignment, optionally prefixed with `export`.
+// Lines starting with "#" and trailing " #" comments of unquoted values are ignored.
+// Single quoted values are taken literally, double quoted values may contain
+// escape sequences, and both may span multiple lines. References like $VAR,
+// ${VAR:-default} or the other shell parameter expansions in unquoted and double
+// quoted values are expanded with the variables visible in e.
+func (e *EnvSet) Load(paths ...string) error {
+	for _, path := range paths {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = e.parseDotenv(string(src)); err != nil {
+			return fmt.Errorf("%s:%v", path, err)
+		}
+	}
+	return nil
+}
+
+// parseDotenv parses src in dotenv format into e
+func (e *EnvSet) parseDotenv(src string) error {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	line := 1
+	for pos := 0; pos < len(src); {
+		end := strings.IndexByte(src[pos:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += pos
+		}
+		stmt := strings.TrimSpace(src[pos:end])
+		if stmt == "" || stmt[0] == '#' {
+			pos, line = end+1, line+1
+			continue
+		}
+		if strings.HasPrefix(stmt, "export ") || strings.HasPrefix(stmt, "export\t") {
+			stmt = strings.TrimSpace(stmt[len("export"):])
+		}
+		eq := strings.IndexByte(stmt, '=')
+		if eq < 0 {
+			return fmt.Errorf("%d: %v", line, &EnvSyntaxError{stmt, "missing \"=\""})
+		}
+		key := strings.TrimSpace(stmt[:eq])
+		if _, _, err := parseAssignment(key + "="); err != nil {
+			return fmt.Errorf("%d: %v", line, err)
+		}
+
+		// the value may span several lines if quoted, so continue from the source
+		start := pos + strings.IndexByte(src[pos:], '=') + 1
+		for start < len(src) && (src[start] == ' ' || src[start] == '\t') {
+			start++
+		}
+		val, next, err := e.dotenvValue(key, src, start)
+		if err != nil {
+			return fmt.Errorf("%d: %s: %v", line, key, err)
+		}
+		e.put(key, val)
+		if next > len(src) {
+			next = len(src)
+		}
+		line += strings.Count(src[pos:next], "\n")
+		pos = next
+	}
+	return nil
+}
+
+// dotenvValue parses the value starting at src[pos] and returns it
+// with the position following the end of its line
+func (e *EnvSet) dotenvValue(key, src string, pos int) (val string, next int, err error) {
+	eol := func(from int) (int, error) {
+		end := strings.IndexByte(src[from:], '\n')
+		if end < 0 {
+			end = len(src) - from
+		}
+		if rest := strings.TrimSpace(src[from : from+end]); rest != "" && rest[0] != '#' {
+			return 0, fmt.Errorf("unexpected characters after quoted value: %q", rest)
+		}
+		return from + end + 1, nil
+	}
+	if pos >= len(src) {
+		return "", pos, nil
+	}
+
+	switch src[pos] {
+	case '\'':
+		end := strings.IndexByte(src[pos+1:], '\'')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated single quote")
+		}
+		next, err = eol(pos + end + 2)
+		return src[pos+1 : pos+1+end], next, err
+
+	case '"':
+		var b strings.Builder
+		// raw text pending expansion
+		var raw strings.Builder
+		flush := func() error {
+			s, err := expand(translatePathList(key, raw.String()), e)
+			b.WriteString(s)
+			raw.Reset()
+			return err
+		}
+		for i := pos + 1; i < len(src); i++ {
+			switch c := src[i]; {
+			case c == '"':
+				if err = flush(); err != nil {
+					return "", 0, err
+				}
+				next, err = eol(i + 1)
+				return b.String(), next, err
+			case c == '\\' && i+1 < len(src):
+				i++
+				switch src[i] {
+				case 'n':
+					raw.WriteByte('\n')
+				case 't':
+					raw.WriteByte('\t')
+				case 'r':
+					raw.WriteByte('\r')
+				case '$':
+					// escaped dollar is never expanded
+					if err = flush(); err != nil {
+						return "", 0, err
+					}
+					b.WriteByte('$')
+				case '"', '\\':
+					raw.WriteByte(src[i])
+				default:
+					raw.WriteByte('\\')
+					raw.WriteByte(src[i])
+				}
+			default:
+				raw.WriteByte(c)
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated double quote")
+
+	default:
+		end := strings.IndexByte(src[pos:], '\n')
+		if end < 0 {
+			end = len(src) - pos
+		}
+		s := src[pos : pos+end]
+		for i := 1; i < len(s); i++ {
+			if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+				s = s[:i]
+				break
+			}
+		}
+		val, err = expand(translatePathList(key, strings.TrimSpace(s)), e)
+		return val, pos + end + 1, err
+	}
+}
+
+func withEnvFile(path string, run Runnable) Runnable {
+	return runner(func() error {
+		env := Env
+		defer func() {
+			Env = env
+		}()
+		Env = Env.Layer(WithLayer)
+		if err := Env.Load(path); err != nil {
+			return err
+		}
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package run
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	env, _ := NewEnv()
+	assert.NoError(t, env.Load("test/app.env"))
+	assert.Equal(t, []string{
+		"APP_NAME=go-run",
+		"APP_HOME=/srv/go-run",
+		"APP_URL=http://localhost#anchor",
+		"APP_LITERAL=$APP_NAME # not a comment",
+		"APP_QUOTED=go-run says \"hi\"\tand costs $5",
+		"APP_PORT=8080",
+		"APP_CERT=-----BEGIN-----\nabc\n-----END-----",
+		"APP_EMPTY=",
+	}, env.List())
+}
+
+func TestLoadErrors(t *testing.T) {
+	env, _ := NewEnv()
+	for src, msg := range map[string]string{
+		"A=a\nNOVALUE\n":      `2: invalid env assignment "NOVALUE": missing "="`,
+		"A=a\nB=\"b\n\nC=c":   `2: B: unterminated double quote`,
+		"A='a\nb'\nB='b' c\n": `3: B: unexpected characters after quoted value: "c"`,
+		"MY VAR=a":            `1: invalid env assignment "MY VAR=": invalid character in name`,
+	} {
+		err := env.parseDotenv(src)
+		if assert.Error(t, err, src) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+	assert.Error(t, env.Load("test/doesnotexist.env"))
+}
+
+func TestWithEnvFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	Shell(`echo -n $APP_HOME:$APP_PORT`).WithEnvFile("test/app.env").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "/srv/go-run:8080", output.String())
+	_, ok := Env.Lookup("APP_HOME")
+	assert.False(t, ok, "WithEnvFile should only be valid within the chain")
+}
@@ -1,108 +1,369 @@
-package run 
+package run
 
 import (
+	"fmt"
 	"os"
 	"strings"
-	"fmt"
+
 	flag "github.com/Fiery/pflag"
 )
 
-func init(){
-	//flag.Parse()
- 	//Env = makeEnvMap(flag.Args(), false)
+// Layer names reported by EnvSet.Explain, from the outermost to the innermost scope
+const (
+	// ProcessLayer is the environment of the current process
+	ProcessLayer = "process"
+	// GlobalLayer is the package level run.Env
+	GlobalLayer = "global"
+	// WithLayer is set by Runnable.With for the chain
+	WithLayer = "with"
+	// CommandLayer is the assignment prefix of a single command line
+	CommandLayer = "command"
+)
+
+// EnvSet is an ordered set of environment variables.
+// A set may be layered over a parent scope, whose variables are visible
+// unless overridden or unset in the child.
+type EnvSet struct {
+	layer  string
+	parent *EnvSet
+	// keys keeps the insertion order of vals
+	keys []string
+	vals map[string]string
+	// unset masks variables of the parent scopes
+	unset map[string]bool
+	// secret marks variables whose values must not be exposed
+	secret map[string]bool
+	// process layers read and write the os environment directly
+	process bool
+	// filter restricts the variables inherited from the process layer
+	filter envFilter
 }
 
+// envFilter restricts which process variables are inherited by child processes
+type envFilter struct {
+	// isolated inherits the allowed variables only
+	isolated bool
+	allow    []string
+	deny     []string
+}
 
-// Uses map to easily update/change/fetch variables
-type envMap map[string]string
+// MinimalEnv is a minimal allowlist for Isolate, enough to find binaries and temporary directories
+var MinimalEnv = []string{"PATH", "HOME", "TMPDIR", "TEMP", "TMP", "USERPROFILE", "SystemRoot", "ComSpec", "PATHEXT"}
 
-// Env is the default environment to use for all commands.
-// os.exec.Cmd takes environment from the merged set
-// of global environment and this Env set. 
-var Env = makeEnvMap(flag.Args(), false)
+// inherits reports whether the variable passes the filter
+func (f *envFilter) inherits(key string) bool {
+	for _, p := range f.deny {
+		if matchGlob(p, key) {
+			return false
+		}
+	}
+	if !f.isolated {
+		return true
+	}
+	for _, p := range f.allow {
+		if matchGlob(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// processLookup returns the value of an inherited process variable
+func (e *EnvSet) processLookup(key string) (string, bool) {
+	if !e.filter.inherits(key) {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
 
+// processEnv is the live view of the os environment, root of run.Env
+var processEnv = &EnvSet{layer: ProcessLayer, process: true}
 
-// PathListSeparator is a cross-platform path list separator template. 
+// Env is the default environment to use for all commands.
+// It is layered over the process environment, so os.exec.Cmd takes
+// the process environment overridden by this Env set.
+var Env = newGlobalEnv(flag.Args()...)
+
+// PathListSeparator is a cross-platform path list separator template.
 // Will be replaced according to different go runtim (Windows: ";", Unix/BSD: ":")
+// in the values of PathListKeys
 var PathListSeparator = "::"
 
-// Set takes arbitrary number of env assigment and update the mapping in-place
-func (e *envMap) Set(set ...string){
-	for key, val:= range *makeEnvMap(set, false, e){
-		(*e)[key] = val
-	}
+// newGlobalEnv returns a global layer over the process environment, malformed entries are ignored
+func newGlobalEnv(set ...string) *EnvSet {
+	env := processEnv.Layer(GlobalLayer)
+	env.Set(set...)
+	return env
+}
+
+// NewEnv returns a standalone EnvSet holding the given assignments
+func NewEnv(set ...string) (*EnvSet, error) {
+	env := &EnvSet{}
+	return env, env.Set(set...)
 }
 
+// Layer returns a new empty scope named name on top of e
+func (e *EnvSet) Layer(name string) *EnvSet {
+	return &EnvSet{layer: name, parent: e}
+}
 
+// Lookup returns the value of key and whether it is set in any scope
+func (e *EnvSet) Lookup(key string) (string, bool) {
+	for s := e; s != nil; s = s.parent {
+		if s.process {
+			return s.processLookup(key)
+		}
+		if v, ok := s.vals[key]; ok {
+			return v, true
+		}
+		if s.unset[key] {
+			return "", false
+		}
+	}
+	return "", false
+}
 
-// list returns `os` friendly env assignment list
-func (e *envMap) list() (r []string){
+// Get returns the value of key, or an empty string if it is not set
+func (e *EnvSet) Get(key string) string {
+	v, _ := e.Lookup(key)
+	return v
+}
 
-	for key, val:= range *e{
-		if strings.Contains(val, PathListSeparator) {
-			val = strings.Replace(val, PathListSeparator, string(os.PathListSeparator), -1)
+// Explain reports the name of the layer the value of key comes from,
+// or an empty string if key is not set
+func (e *EnvSet) Explain(key string) string {
+	for s := e; s != nil; s = s.parent {
+		if s.process {
+			if _, ok := s.processLookup(key); ok {
+				return s.layer
+			}
+			return ""
+		}
+		if _, ok := s.vals[key]; ok {
+			return s.layer
+		}
+		if s.unset[key] {
+			return ""
 		}
-		r = append(r, strings.Join([]string{key, val},"="))
+	}
+	return ""
+}
+
+// Set takes arbitrary number of env assigment and update the mapping in-place.
+// Entries are applied in order, so references to variables set by preceding
+// entries are expanded with their new value. Values support shell parameter
+// expansion like ${VAR:-default} or ${VAR:?error}.
+// Malformed entries are skipped and the first one is reported as *EnvSyntaxError,
+// failed expansions as *ParamError.
+func (e *EnvSet) Set(set ...string) (err error) {
+	for _, kv := range set {
+		key, val, perr := parseAssignment(kv)
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		if val, perr = expand(translatePathList(key, val), e); perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		e.put(key, val)
 	}
 	return
+}
+
+// EnvSyntaxError reports a malformed env assignment
+type EnvSyntaxError struct {
+	Entry string
+	Msg   string
+}
 
+func (e *EnvSyntaxError) Error() string {
+	return fmt.Sprintf("invalid env assignment %q: %s", e.Entry, e.Msg)
 }
 
-// promote promotes a runtime env var to global env set
-func (e *envMap) promote(key string) error{
-	if val, ok:=(*e)[key]; !ok{
-		return fmt.Errorf("Cannot escalate env that are not included in current env map!")
-	}else{
-		return os.Setenv(key,val)
+// parseAssignment splits a `key=value` entry on the first "="
+func parseAssignment(kv string) (key, val string, err error) {
+	i := strings.Index(kv, "=")
+	switch {
+	case i < 0:
+		return "", "", &EnvSyntaxError{kv, "missing \"=\""}
+	case i == 0:
+		return "", "", &EnvSyntaxError{kv, "empty name"}
+	case strings.ContainsAny(kv[:i], " \t\r\n\"'$"):
+		return "", "", &EnvSyntaxError{kv, "invalid character in name"}
 	}
+	return kv[:i], kv[i+1:], nil
+}
 
+// put stores the value in the scope of e
+func (e *EnvSet) put(key, val string) {
+	if e.process {
+		os.Setenv(key, val)
+		return
+	}
+	if e.vals == nil {
+		e.vals = make(map[string]string)
+	}
+	if _, ok := e.vals[key]; !ok {
+		e.keys = append(e.keys, key)
+	}
+	e.vals[key] = val
+	delete(e.unset, key)
+	delete(e.secret, key)
 }
 
-// consolidate consolidates input environment variables in given set and returns a new envMap 
-func (e *envMap) combine(envset []string) *envMap {
-	final := *makeEnvMap(envset, false, e)
-	for key,val:= range *e{
-		if _, ok:=final[key];!ok{
-			final[key] = val
+// Unset removes the keys from e, hiding them in the parent scopes as well
+func (e *EnvSet) Unset(keys ...string) {
+	for _, key := range keys {
+		if e.process {
+			os.Unsetenv(key)
+			continue
+		}
+		if _, ok := e.vals[key]; ok {
+			delete(e.vals, key)
+			delete(e.secret, key)
+			for i, k := range e.keys {
+				if k == key {
+					e.keys = append(e.keys[:i], e.keys[i+1:]...)
+					break
+				}
+			}
+		}
+		if _, ok := e.parent.Lookup(key); ok {
+			if e.unset == nil {
+				e.unset = make(map[string]bool)
+			}
+			e.unset[key] = true
 		}
 	}
-	return &final
 }
 
+// Clone returns a deep copy of e and its parent scopes
+func (e *EnvSet) Clone() *EnvSet {
+	if e == nil || e.process {
+		return e
+	}
+	c := &EnvSet{
+		layer:  e.layer,
+		parent: e.parent.Clone(),
+		keys:   append([]string(nil), e.keys...),
+		vals:   make(map[string]string, len(e.vals)),
+		unset:  make(map[string]bool, len(e.unset)),
+		secret: make(map[string]bool, len(e.secret)),
+	}
+	for k, v := range e.vals {
+		c.vals[k] = v
+	}
+	for k := range e.unset {
+		c.unset[k] = true
+	}
+	for k := range e.secret {
+		c.secret[k] = true
+	}
+	return c
+}
 
-// makeEnvMap parse the given env string set and returns a new envMap
-func makeEnvMap(set []string, inherit bool, ref ...*envMap) *envMap {
-	env := make(envMap)
-	for _, kv := range set {
-		if strings.Contains(kv, PathListSeparator){
-			kv = strings.Replace(kv, PathListSeparator, string(os.PathListSeparator), -1)
-		}
-
-		kv = os.Expand(kv, func(key string) string{
-			for _, r := range append(ref, &env){
-				if v,ok:=(*r)[key];ok{
-					return v
+// Merge copies all variables visible in the other sets into the scope of e, in order,
+// secret variables staying secret.
+// It returns e to allow chaining.
+func (e *EnvSet) Merge(others ...*EnvSet) *EnvSet {
+	for _, o := range others {
+		for _, key := range o.Keys() {
+			e.put(key, o.Get(key))
+			// secret values stay secret in e, as in a Clone
+			if o.IsSecret(key) && !e.process {
+				if e.secret == nil {
+					e.secret = make(map[string]bool)
 				}
+				e.secret[key] = true
 			}
-			if v:=os.Getenv(key); inherit && v!=""{ 
-				return v
-			}else{
-				return ""//key 
+		}
+	}
+	return e
+}
+
+// Keys returns the names of all visible variables,
+// in the order they were first set from the outermost scope
+func (e *EnvSet) Keys() (keys []string) {
+	if e == nil {
+		return nil
+	}
+	if e.process {
+		for _, kv := range os.Environ() {
+			if i := strings.Index(kv, "="); i > 0 && e.filter.inherits(kv[:i]) {
+				keys = append(keys, kv[:i])
 			}
+		}
+		return
+	}
+	for _, key := range e.parent.Keys() {
+		if !e.unset[key] {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range e.keys {
+		if _, ok := e.parent.Lookup(key); !ok {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
 
-		})
+// Len returns the number of visible variables
+func (e *EnvSet) Len() int {
+	return len(e.Keys())
+}
 
-		if pair:= strings.Split(kv,"=");len(pair)<2{
-			env[pair[0]] = ""
-		}else if len(pair)>2{
-			pair = strings.FieldsFunc(kv, getQuoteSplitter('='))
-			env[pair[0]] = pair[1]		
-		}else{			
-			env[pair[0]] = pair[1]
-		
-		}
+// List returns `os` friendly env assignment list, ordered as Keys
+func (e *EnvSet) List() (r []string) {
+	for _, key := range e.Keys() {
+		r = append(r, key+"="+e.Get(key))
+	}
+	return
+}
 
+// String lists the variables set above the process layer, with secret values redacted
+func (e *EnvSet) String() string {
+	var own []string
+	for _, key := range e.ownKeys() {
+		if e.IsSecret(key) {
+			own = append(own, key+"="+Redacted)
+		} else {
+			own = append(own, key+"="+e.Get(key))
+		}
 	}
-	return &env
+	return strings.Join(own, " ")
 }
 
+func isolate(allow []string, run Runnable) Runnable {
+	return runner(func() error {
+		filter := processEnv.filter
+		defer func() {
+			processEnv.filter = filter
+		}()
+		processEnv.filter.isolated = true
+		processEnv.filter.allow = allow
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
+
+func deny(patterns []string, run Runnable) Runnable {
+	return runner(func() error {
+		filter := processEnv.filter
+		defer func() {
+			processEnv.filter = filter
+		}()
+		processEnv.filter.deny = append(append([]string(nil), filter.deny...), patterns...)
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
@@ -1,7 +1,9 @@
 package run 
 
 import (
+	"bytes"
 	"os"
+	"os/exec"
 	"runtime"
 	"testing"
 
@@ -22,29 +24,30 @@ func init(){
 
 func TestEnvInitialization(t *testing.T) {
 	// set to os defaults
-	Env = makeEnvMap(os.Environ(), false)
+	Env = newGlobalEnv()
 	Env.Set("USER=$USER:run")
-	assert.Equal(t, user+":run", (*Env)["USER"], "Environment interpretation failed")
+	assert.Equal(t, user+":run", Env.Get("USER"), "Environment interpretation failed")
 }
 func TestEnvCombination(t *testing.T){
 	// set to os defaults
-	Env = makeEnvMap(os.Environ(), false)
-	Env = Env.combine([]string{"USER=$USER:$USER:func"})
+	Env = newGlobalEnv()
+	Env = Env.Layer(WithLayer)
+	Env.Set("USER=$USER:$USER:func")
 	
-	assert.Equal(t, user+":"+user+":func", (*Env)["USER"], "Should have been overriden by func environment")
+	assert.Equal(t, user+":"+user+":func", Env.Get("USER"), "Should have been overriden by func environment")
 	
-	assert.Equal(t, len(os.Environ()), len(*Env),  "Consolidated environment length changed.")
+	assert.Equal(t, len(os.Environ()), Env.Len(),  "Consolidated environment length changed.")
 
-	Env = Env.combine([]string{"GOSU_NEW_VAR=foo"})
-	assert.Equal(t, "foo", (*Env)["GOSU_NEW_VAR"] , "Should have conslidated Env set")
-	assert.Equal(t,  len(os.Environ())+1, len(*Env), "Consolidated environment length should have increased by 1")
+	Env.Set("GOSU_NEW_VAR=foo")
+	assert.Equal(t, "foo", Env.Get("GOSU_NEW_VAR") , "Should have conslidated Env set")
+	assert.Equal(t,  len(os.Environ())+1, Env.Len(), "Consolidated environment length should have increased by 1")
 
 }
 
 func TestEnvQuote(t *testing.T) {
 
-	Env = Env.combine([]string{`FOO="a=bar b=bah c=baz"`})
-	if val, ok:= (*Env)["FOO"]; !ok{
+	Env.Set(`FOO="a=bar b=bah c=baz"`)
+	if val, ok:= Env.Lookup("FOO"); !ok{
 		t.Error("Key insertion failed", Env)
 	}else if val != `"a=bar b=bah c=baz"` {
 		t.Errorf("Quoted var failed %q", val)
@@ -54,33 +57,127 @@ func TestEnvQuote(t *testing.T) {
 func TestEnvInterpretation(t *testing.T) {
 
 	// set back to default
-	Env = makeEnvMap(os.Environ(), false)
+	Env = newGlobalEnv()
 	Env.Set(`USER1=$USER`,`USER2=$USER1`)
 
-	Env = Env.combine([]string{"USER3=$USER2"})
-	assert.Equal(t, user, (*Env)["USER1"], "Should have been evaluated")
-	assert.Equal(t, user, (*Env)["USER3"], "Should have been evaluated during consolidation")
+	env := Env.Layer(CommandLayer)
+	env.Set("USER3=$USER2")
+	assert.Equal(t, user, Env.Get("USER1"), "Should have been evaluated")
+	assert.Equal(t, user, env.Get("USER3"), "Should have been evaluated in child scope")
 
-	Env = Env.combine([]string{"PATH=foo::bar::bah"})
-	assert.Equal(t, "foo"+string(os.PathListSeparator)+"bar"+string(os.PathListSeparator)+"bah", (*Env)["PATH"], "Should have replaced run.PathSeparator")
+	env.Set("PATH=foo::bar::bah")
+	assert.Equal(t, "foo"+string(os.PathListSeparator)+"bar"+string(os.PathListSeparator)+"bah", env.Get("PATH"), "Should have replaced run.PathSeparator")
 
 	// set back to defaults
-	Env = makeEnvMap(os.Environ(),false)
+	Env = newGlobalEnv()
 	Env.Set(`FOO=foo`,`FAIL=$FOObar:run`,`PASS=${FOO}bar:run`)
 
-	assert.Equal(t, ":run", (*Env)["FAIL"], "$FOObar should have been interpreted as empty string.")
-	assert.Equal(t, "foobar:run", (*Env)["PASS"], "${FOO}bar should have been interpreted accordingly.")
+	assert.Equal(t, ":run", Env.Get("FAIL"), "$FOObar should have been interpreted as empty string.")
+	assert.Equal(t, "foobar:run", Env.Get("PASS"), "${FOO}bar should have been interpreted accordingly.")
+}
+
+func TestEnvSet(t *testing.T) {
+	env, err := NewEnv("B=b", "A=a", "C=$A$B")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"B", "A", "C"}, env.Keys(), "Keys should keep insertion order")
+	assert.Equal(t, []string{"B=b", "A=a", "C=ab"}, env.List())
+
+	env.Set("A=z")
+	env.Unset("B")
+	assert.Equal(t, []string{"A=z", "C=ab"}, env.List(), "Overriding should keep the original position")
+
+	clone := env.Clone()
+	clone.Set("D=d")
+	assert.Equal(t, 2, env.Len(), "Clone should not share state")
+	assert.Equal(t, 3, clone.Len())
+
+	c, _ := NewEnv("C=c")
+	e, _ := NewEnv("E=e")
+	env.Merge(c, e)
+	assert.Equal(t, []string{"A=z", "C=c", "E=e"}, env.List())
+}
+
+func TestEnvLayers(t *testing.T) {
+	os.Setenv("TEST_RUN_LAYER", "process")
+	defer os.Unsetenv("TEST_RUN_LAYER")
+
+	global := newGlobalEnv("TEST_RUN_GLOBAL=global")
+	with := global.Layer(WithLayer)
+	with.Set("TEST_RUN_WITH=with", "TEST_RUN_GLOBAL=$TEST_RUN_GLOBAL:with")
+	command := with.Layer(CommandLayer)
+	command.Set("TEST_RUN_COMMAND=command")
+
+	assert.Equal(t, ProcessLayer, command.Explain("TEST_RUN_LAYER"))
+	assert.Equal(t, WithLayer, command.Explain("TEST_RUN_GLOBAL"))
+	assert.Equal(t, GlobalLayer, global.Explain("TEST_RUN_GLOBAL"))
+	assert.Equal(t, WithLayer, command.Explain("TEST_RUN_WITH"))
+	assert.Equal(t, CommandLayer, command.Explain("TEST_RUN_COMMAND"))
+	assert.Equal(t, "", command.Explain("TEST_RUN_NOTSET"))
+	assert.Equal(t, "global:with", command.Get("TEST_RUN_GLOBAL"))
+
+	command.Unset("TEST_RUN_LAYER", "TEST_RUN_WITH")
+	_, ok := command.Lookup("TEST_RUN_LAYER")
+	assert.False(t, ok, "Unset should hide variables of parent scopes")
+	assert.Equal(t, "", command.Explain("TEST_RUN_WITH"))
+	assert.Equal(t, "with", with.Get("TEST_RUN_WITH"), "Unset should not change parent scopes")
+	assert.Equal(t, "process", os.Getenv("TEST_RUN_LAYER"))
+}
+
+func TestEnvParsing(t *testing.T) {
+	env, err := NewEnv(`FLAGS=-ldflags=-X=main.v=1`, `EMPTY=`, `A=a`, `B=$A=$A`, `A=b`, `C=$A`)
+	assert.NoError(t, err)
+	assert.Equal(t, "-ldflags=-X=main.v=1", env.Get("FLAGS"), "Value should be split on the first \"=\" only")
+	assert.Equal(t, []string{"FLAGS=-ldflags=-X=main.v=1", "EMPTY=", "A=b", "B=a=a", "C=b"}, env.List(), "References should be expanded left to right")
+
+	for _, kv := range []string{"NOVALUE", "=value", "MY VAR=value", "$A=value"} {
+		env, err = NewEnv(kv, "VALID=ok")
+		if assert.Error(t, err, kv) {
+			_, ok := err.(*EnvSyntaxError)
+			assert.True(t, ok, "Should have been reported as syntax error")
+		}
+		assert.Equal(t, []string{"VALID=ok"}, env.List(), "Malformed entries should be skipped")
+	}
+}
+
+func TestEnvFilter(t *testing.T) {
+	os.Setenv("RUN_TEST_SECRET", "secret")
+	os.Setenv("RUN_TEST_TOKEN", "token")
+	defer os.Unsetenv("RUN_TEST_SECRET")
+	defer os.Unsetenv("RUN_TEST_TOKEN")
+	Env = newGlobalEnv()
+
+	var output bytes.Buffer
+	Shell(`echo -n "$HOME:$RUN_TEST_SECRET:$RUN_TEST_TOKEN:$t"`).With("t=test").Deny("RUN_TEST_S*").Pipe(Stdout, &output).Run()
+	assert.Equal(t, os.Getenv("HOME")+"::token:test", output.String(), "Denied variables should not be inherited")
+
+	output.Reset()
+	Shell(`echo -n "$HOME:$RUN_TEST_SECRET:$RUN_TEST_TOKEN:$t"`).With("t=test").Isolate("PATH", "RUN_TEST_*").Pipe(Stdout, &output).Run()
+	assert.Equal(t, ":secret:token:test", output.String(), "Only allowed variables should be inherited")
+
+	output.Reset()
+	Shell(`echo -n "$HOME:$RUN_TEST_SECRET:$RUN_TEST_TOKEN"`).Isolate(MinimalEnv...).Deny("HOME").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "::", output.String(), "Deny should apply to the allowlist")
+
+	if path, err := exec.LookPath("env"); err == nil {
+		output.Reset()
+		assert.NoError(t, Call(path).Isolate().Pipe(Stdout, &output).Run())
+		assert.Equal(t, "", output.String(), "Isolate without allowlist should start from an empty env")
+	}
+
+	assert.Equal(t, "secret", Env.Get("RUN_TEST_SECRET"), "Filter should be reset after the chain")
 }
 
 func TestPromotion(t *testing.T) {
 	assert.Equal(t, "", os.Getenv("_foo"))
 	assert.Equal(t, "", os.Getenv("_test_bar"))
 	assert.Equal(t, "", os.Getenv("_test_opts"))
-	Env = makeEnvMap([]string{"_foo", "_test_bar=bah", `_test_opts="a=b,c=d,*="`}, false)
-	for key,_:= range *Env{
-		Env.promote(key)
-	}
+	env, err := NewEnv("_foo", "_test_bar=bah", `_test_opts="a=b,c=d,*="`)
+	assert.Error(t, err, "Entry without assignment should be reported")
+	Env = env
+	assert.Error(t, Env.Promote("_foo"), "Unset keys cannot be promoted")
+	assert.NoError(t, Env.Promote())
 	assert.Equal(t, "", os.Getenv("_foo"))
 	assert.Equal(t, "bah", os.Getenv("_test_bar"))
 	assert.Equal(t, "\"a=b,c=d,*=\"", os.Getenv("_test_opts"))
+	Env = newGlobalEnv()
 }
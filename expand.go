@@ -0,0 +1,300 @@
+package run
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParamError reports a failed parameter expansion,
+// like ${VAR:?message} with VAR unset or a malformed ${...} expression
+type ParamError struct {
+	Name string
+	Msg  string
+}
+
+func (e *ParamError) Error() string {
+	return e.Name + ": " + e.Msg
+}
+
+// paramEnv is the variable scope parameter expansion reads from and assigns to
+type paramEnv interface {
+	Lookup(key string) (string, bool)
+	put(key, val string)
+}
+
+// expander performs shell style parameter expansion
+type expander struct {
+	env paramEnv
+	// nounset reports references to unset variables as errors
+	nounset bool
+}
+
+// expand substitutes parameter references in s with values from env.
+// Besides $VAR and ${VAR} it supports the POSIX forms
+//
+//	${VAR:-default} ${VAR:=default} ${VAR:?error} ${VAR:+alt}
+//	${#VAR} ${VAR#prefix} ${VAR##prefix} ${VAR%suffix} ${VAR%%suffix}
+//
+// where the colon may be omitted to test for unset only, and prefix and
+// suffix are glob patterns. Unset variables expand to an empty string.
+func expand(s string, env paramEnv) (string, error) {
+	return expander{env: env}.expand(s)
+}
+
+func (x expander) expand(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		var val string
+		var err error
+		switch c := s[i+1]; {
+		case c == '{':
+			end := matchBrace(s, i+1)
+			if end < 0 {
+				return "", &ParamError{s[i:], "bad substitution"}
+			}
+			val, err = x.param(s[i+2 : end])
+			i = end
+		case isNameStart(c):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			val, err = x.value(s[i+1 : j])
+			i = j - 1
+		case c >= '0' && c <= '9', strings.IndexByte("?#@*", c) >= 0:
+			val, err = x.value(string(c))
+			i++
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+	}
+	return b.String(), nil
+}
+
+// value returns the value of a plain reference
+func (x expander) value(name string) (string, error) {
+	val, ok := x.env.Lookup(name)
+	if !ok && x.nounset && name != "@" && name != "*" {
+		return "", &ParamError{name, "parameter not set"}
+	}
+	return val, nil
+}
+
+// matchBrace returns the index of the brace closing the one at open, or -1
+func matchBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isParam reports whether name is a variable, positional or special parameter
+func isParam(name string) bool {
+	if isName(name) || len(name) == 1 && strings.IndexByte("?#@*", name[0]) >= 0 {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// param evaluates the content of a ${...} expression
+func (x expander) param(expr string) (string, error) {
+	if len(expr) > 1 && expr[0] == '#' {
+		if !isParam(expr[1:]) {
+			return "", &ParamError{"${" + expr + "}", "bad substitution"}
+		}
+		val, err := x.value(expr[1:])
+		return strconv.Itoa(utf8.RuneCountInString(val)), err
+	}
+
+	i := 0
+	if expr != "" && strings.IndexByte("?#@*", expr[0]) >= 0 {
+		i = 1
+	} else {
+		for i < len(expr) && isNameChar(expr[i]) {
+			i++
+		}
+	}
+	name, op := expr[:i], expr[i:]
+	if !isParam(name) {
+		return "", &ParamError{"${" + expr + "}", "bad substitution"}
+	}
+	if op == "" {
+		return x.value(name)
+	}
+
+	val, ok := x.env.Lookup(name)
+	colon := op[0] == ':'
+	if colon {
+		op = op[1:]
+	}
+	// set reports whether the parameter counts as set for the operator
+	set := ok && (!colon || val != "")
+	if op == "" {
+		return "", &ParamError{"${" + expr + "}", "bad substitution"}
+	}
+	word := op[1:]
+
+	switch op[0] {
+	case '-':
+		if set {
+			return val, nil
+		}
+		return x.expand(word)
+	case '=':
+		if set {
+			return val, nil
+		}
+		if !isName(name) {
+			return "", &ParamError{name, "cannot assign in this way"}
+		}
+		val, err := x.expand(word)
+		if err == nil {
+			x.env.put(name, val)
+		}
+		return val, err
+	case '?':
+		if set {
+			return val, nil
+		}
+		msg, err := x.expand(word)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "parameter not set"
+			if colon {
+				msg = "parameter null or not set"
+			}
+		}
+		return "", &ParamError{name, msg}
+	case '+':
+		if set {
+			return x.expand(word)
+		}
+		return "", nil
+	}
+
+	if colon {
+		return "", &ParamError{"${" + expr + "}", "bad substitution"}
+	}
+	if !ok && x.nounset {
+		return "", &ParamError{name, "parameter not set"}
+	}
+	switch {
+	case strings.HasPrefix(op, "##"):
+		return x.trim(val, op[2:], true, true)
+	case op[0] == '#':
+		return x.trim(val, op[1:], true, false)
+	case strings.HasPrefix(op, "%%"):
+		return x.trim(val, op[2:], false, true)
+	case op[0] == '%':
+		return x.trim(val, op[1:], false, false)
+	}
+	return "", &ParamError{"${" + expr + "}", "bad substitution"}
+}
+
+// trim removes the shortest or longest prefix or suffix of val matching the glob pattern
+func (x expander) trim(val, pattern string, prefix, longest bool) (string, error) {
+	pattern, err := x.expand(pattern)
+	if err != nil {
+		return "", err
+	}
+	n := len(val)
+	for k := 0; k <= n; k++ {
+		l := k
+		if longest {
+			l = n - k
+		}
+		if prefix && matchGlob(pattern, val[:l]) {
+			return val[l:], nil
+		}
+		if !prefix && matchGlob(pattern, val[n-l:]) {
+			return val[:n-l], nil
+		}
+	}
+	return val, nil
+}
+
+// matchGlob reports whether s matches the shell pattern, where `*` matches any string
+// including "/", `?` any single character and `[...]` a character class
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			pattern, s = pattern[1:], s[size:]
+			continue
+		case '[':
+			if end := strings.IndexByte(pattern[1:], ']'); end > 0 && s != "" {
+				r, size := utf8.DecodeRuneInString(s)
+				if !matchClass(pattern[1:end+1], r) {
+					return false
+				}
+				pattern, s = pattern[end+2:], s[size:]
+				continue
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if s == "" || s[0] != pattern[0] {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// matchClass reports whether r is in the bracket expression class, e.g. "a-z_" or "!0-9"
+func matchClass(class string, r rune) bool {
+	negate := class[0] == '!' || class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	runes := []rune(class)
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '-' {
+			if runes[i] <= r && r <= runes[i+2] {
+				return !negate
+			}
+			i += 2
+		} else if runes[i] == r {
+			return !negate
+		}
+	}
+	return negate
+}
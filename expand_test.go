@@ -0,0 +1,71 @@
+package run
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	env, _ := NewEnv("FILE=/usr/src/main.tar.gz", "EMPTY=", "NAME=run")
+	for in, out := range map[string]string{
+		"$NAME ${NAME}":        "run run",
+		"${UNSET:-def}":        "def",
+		"${EMPTY:-def}":        "def",
+		"${EMPTY-def}":         "",
+		"${UNSET:-${NAME}}":    "run",
+		"${NAME:+alt}":         "alt",
+		"${EMPTY:+alt}":        "",
+		"${EMPTY+alt}":         "alt",
+		"${#NAME} ${#UNSET}":   "3 0",
+		"${FILE#*/}":           "usr/src/main.tar.gz",
+		"${FILE##*/}":          "main.tar.gz",
+		"${FILE%.*}":           "/usr/src/main.tar",
+		"${FILE%%.*}":          "/usr/src/main",
+		"${FILE%.[a-z][a-z]}":  "/usr/src/main.tar",
+		"${FILE##*[!a-z.]}":    "main.tar.gz",
+		"${FILE#$NAME}":        "/usr/src/main.tar.gz",
+		"${NAME:?} $ $1 cost$": "run $  cost$",
+	} {
+		val, err := expand(in, env)
+		assert.NoError(t, err, in)
+		assert.Equal(t, out, val, in)
+	}
+
+	val, err := expand("${ASSIGNED:=$NAME-dev}", env)
+	assert.NoError(t, err)
+	assert.Equal(t, "run-dev", val)
+	assert.Equal(t, "run-dev", env.Get("ASSIGNED"), ":= should have assigned the default")
+}
+
+func TestExpandErrors(t *testing.T) {
+	env, _ := NewEnv("EMPTY=")
+	for in, msg := range map[string]string{
+		"${UNSET:?}":               "UNSET: parameter null or not set",
+		"${EMPTY:?}":               "EMPTY: parameter null or not set",
+		"${UNSET?}":                "UNSET: parameter not set",
+		"${UNSET:?token required}": "UNSET: token required",
+		"${NAME":                   "${NAME: bad substitution",
+		"${NAME/a/b}":              "${NAME/a/b}: bad substitution",
+		"${1:=a}":                  "1: cannot assign in this way",
+	} {
+		_, err := expand(in, env)
+		var perr *ParamError
+		if assert.True(t, errors.As(err, &perr), in) {
+			assert.Equal(t, msg, perr.Error())
+		}
+	}
+
+	_, err := expander{env: env, nounset: true}.expand("$UNSET")
+	assert.Error(t, err, "Nounset should report unset variables")
+}
+
+func TestExpandCommand(t *testing.T) {
+	err := Call("${RUN_TEST_BIN:?binary required} --version").Run()
+	var perr *ParamError
+	assert.True(t, errors.As(err, &perr), "Should have failed with ParamError before running")
+
+	_, err = NewEnv("TOKEN=${RUN_TEST_TOKEN:?}")
+	assert.True(t, errors.As(err, &perr), "Set should report ParamError")
+}
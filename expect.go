@@ -0,0 +1,185 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ExpectTimeout is the time an ExpectStep waits for its pattern by default
+var ExpectTimeout = 10 * time.Second
+
+// ExpectBufferBytes is the maximum output kept for the patterns, older output is dropped
+var ExpectBufferBytes = 64 << 10
+
+// ExpectStep waits for a regular expression in the output of the command and answers it
+type ExpectStep struct {
+	// Pattern is the regular expression to wait for in stdout or stderr,
+	// matched against the output received since the previous step, at most ExpectBufferBytes
+	Pattern string
+	// Send is written to stdin followed by a newline once Pattern matched
+	Send string
+	// Timeout is the maximum wait for Pattern, ExpectTimeout if zero
+	Timeout time.Duration
+}
+
+// ExpectError reports an ExpectStep whose pattern was not found
+type ExpectError struct {
+	Pattern string
+	// Output is the output received since the previous step
+	Output string
+	// Timeout is set if the step timed out, the process is killed then.
+	// Otherwise the process exited before the pattern was found.
+	Timeout time.Duration
+}
+
+func (e *ExpectError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("expect %q: timed out after %v", e.Pattern, e.Timeout)
+	}
+	return fmt.Sprintf("expect %q: process exited", e.Pattern)
+}
+
+// expectSteps are the steps of the running chain, nil if not set
+var expectSteps []expectStep
+
+type expectStep struct {
+	ExpectStep
+	re *regexp.Regexp
+}
+
+// expectSession drives the interaction with a single process
+type expectSession struct {
+	steps []expectStep
+	// in is the write end of the stdin of the process
+	in, inRead *os.File
+
+	mu sync.Mutex
+	// out is the output received since the previous step, the last ExpectBufferBytes of it
+	out []byte
+	// changed is signaled when output is received or the process exited
+	changed chan struct{}
+	exited  bool
+	// done is closed once the steps ended, with err
+	done chan struct{}
+	err  error
+}
+
+// newExpectSession returns a session for the steps, replacing the stdin of the app
+func newExpectSession(steps []expectStep) (*expectSession, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &expectSession{
+		steps:   steps,
+		in:      w,
+		inRead:  r,
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// Write receives the output of the process
+func (e *expectSession) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	e.out = append(e.out, p...)
+	if n := len(e.out) - ExpectBufferBytes; n > 0 && ExpectBufferBytes > 0 {
+		e.out = append(e.out[:0], e.out[n:]...)
+	}
+	e.mu.Unlock()
+	e.signal()
+	return len(p), nil
+}
+
+func (e *expectSession) signal() {
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+}
+
+// begin runs the steps against the started process
+func (e *expectSession) begin(p *os.Process) {
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		defer e.in.Close()
+		for _, step := range e.steps {
+			if e.err = e.expect(step, p); e.err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// expect waits for the pattern of the step and sends its answer
+func (e *expectSession) expect(step expectStep, p *os.Process) error {
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = ExpectTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		e.mu.Lock()
+		loc, exited := step.re.FindIndex(e.out), e.exited
+		if loc != nil {
+			e.out = e.out[loc[1]:]
+		}
+		out := string(e.out)
+		e.mu.Unlock()
+		switch {
+		case loc != nil:
+			_, err := io.WriteString(e.in, step.Send+"\n")
+			return err
+		case exited:
+			return &ExpectError{Pattern: step.Pattern, Output: out}
+		}
+		select {
+		case <-e.changed:
+		case <-timer.C:
+			p.Kill()
+			return &ExpectError{Pattern: step.Pattern, Output: out, Timeout: timeout}
+		}
+	}
+}
+
+// Close ends the steps once the process exited and reports the first failed one
+func (e *expectSession) Close() error {
+	e.mu.Lock()
+	e.exited = true
+	e.mu.Unlock()
+	e.signal()
+	if e.done != nil {
+		<-e.done
+	} else {
+		e.in.Close()
+	}
+	e.inRead.Close()
+	return e.err
+}
+
+func expect(steps []ExpectStep, run Runnable) Runnable {
+	return runner(func() error {
+		compiled := make([]expectStep, len(steps))
+		for i, s := range steps {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return err
+			}
+			compiled[i] = expectStep{s, re}
+		}
+		old := expectSteps
+		defer func() {
+			expectSteps = old
+		}()
+		expectSteps = compiled
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestExpect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	err := Shell(`printf 'name? '; read name; echo "age of $name?" >&2; read age; echo "$name is $age"; read rest; echo "rest=$rest"`).Expect(
+		ExpectStep{Pattern: `name\? $`, Send: "ann"},
+		ExpectStep{Pattern: `age of (\w+)\?`, Send: "42"},
+	).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "name? ann is 42\nrest=\n", output.String(), "Answers should be sent and stdin closed after the last step")
+
+	start := time.Now()
+	err = Shell(`echo waiting; exec sleep 5`).Expect(ExpectStep{Pattern: "never", Timeout: 100 * time.Millisecond}).Run()
+	var e *ExpectError
+	assert.True(t, errors.As(err, &e), err)
+	assert.Equal(t, "never", e.Pattern)
+	assert.Equal(t, "waiting\n", e.Output)
+	assert.Equal(t, 100*time.Millisecond, e.Timeout)
+	assert.True(t, time.Since(start) < 3*time.Second, "The process should be killed on timeout")
+
+	err = Shell(`echo bye`).Expect(ExpectStep{Pattern: "hello"}).Run()
+	assert.True(t, errors.As(err, &e), err)
+	assert.Equal(t, `expect "hello": process exited`, e.Error())
+
+	assert.Error(t, Call("true").Expect(ExpectStep{Pattern: "("}).Run(), "Invalid patterns should be reported")
+}
+
+func TestExpectBuffer(t *testing.T) {
+	old := ExpectBufferBytes
+	ExpectBufferBytes = 1024
+	defer func() {
+		ExpectBufferBytes = old
+	}()
+	e, err := newExpectSession(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 100; i++ {
+		e.Write(bytes.Repeat([]byte{'x'}, 100))
+	}
+	e.Write([]byte("end"))
+	assert.Equal(t, 1024, len(e.out), "The output should be capped")
+	assert.Equal(t, "xend", string(e.out[1020:]), "The last output should be kept")
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	err = Shell(`head -c 100000 /dev/zero | tr '\0' x; printf '\nname? '; read name; echo "hi $name"`).Expect(
+		ExpectStep{Pattern: `name\? $`, Send: "ann"},
+	).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err, "Patterns should match after long output")
+	assert.True(t, bytes.HasSuffix(output.Bytes(), []byte("name? hi ann\n")), "Answers should be sent after long output")
+}
+
+func TestExpectTty(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	err := Shell(`stty -echo; printf 'password: '; read pw; stty echo; echo; [ -t 0 ] && echo "got $pw"`).Tty().Expect(
+		ExpectStep{Pattern: `password: `, Send: "s3cr3t"},
+	).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "password: \r\ngot s3cr3t\r\n", output.String())
+}
@@ -0,0 +1,162 @@
+package run
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EnvFormat is a serialization format of EnvSet.Write
+type EnvFormat int
+
+const (
+	// DotenvFormat writes `KEY=value` lines readable by EnvSet.Load
+	DotenvFormat EnvFormat = iota
+	// ShellFormat writes `export KEY='value'` lines to be sourced by a POSIX shell
+	ShellFormat
+	// JSONFormat writes a JSON object of the variables, in order
+	JSONFormat
+	// GithubEnvFormat writes entries for the file named by $GITHUB_ENV in GitHub Actions,
+	// multiline values use the heredoc syntax
+	GithubEnvFormat
+)
+
+// ownKeys returns the visible keys whose values are set above the process layer
+func (e *EnvSet) ownKeys() (keys []string) {
+	for _, key := range e.Keys() {
+		if e.Explain(key) != ProcessLayer {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// Promote exports the variables to the environment of the current process with os.Setenv,
+// so they are seen by code reading the os environment directly.
+// Without keys, all variables set above the process layer are exported.
+func (e *EnvSet) Promote(keys ...string) error {
+	if len(keys) == 0 {
+		keys = e.ownKeys()
+	}
+	for _, key := range keys {
+		val, ok := e.Lookup(key)
+		if !ok {
+			return fmt.Errorf("cannot promote %s: not set in env", key)
+		}
+		if err := os.Setenv(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write serializes the variables to w in the given format.
+// Without keys, all variables set above the process layer are written.
+// Secret values are written as is, the output is meant to be read by other processes.
+func (e *EnvSet) Write(w io.Writer, format EnvFormat, keys ...string) error {
+	if len(keys) == 0 {
+		keys = e.ownKeys()
+	}
+	for _, key := range keys {
+		if _, ok := e.Lookup(key); !ok {
+			return fmt.Errorf("cannot write %s: not set in env", key)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	switch format {
+	case DotenvFormat:
+		for _, key := range keys {
+			fmt.Fprintf(bw, "%s=%s\n", key, dotenvQuote(e.Get(key)))
+		}
+	case ShellFormat:
+		for _, key := range keys {
+			fmt.Fprintf(bw, "export %s=%s\n", key, shellQuote(e.Get(key)))
+		}
+	case JSONFormat:
+		// encoding/json sorts map keys, write the object by hand to keep the order
+		bw.WriteString("{")
+		for i, key := range keys {
+			k, _ := json.Marshal(key)
+			v, _ := json.Marshal(e.Get(key))
+			if i > 0 {
+				bw.WriteString(",")
+			}
+			fmt.Fprintf(bw, "\n  %s: %s", k, v)
+		}
+		if len(keys) > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("}\n")
+	case GithubEnvFormat:
+		for _, key := range keys {
+			val := e.Get(key)
+			if !strings.ContainsAny(val, "\r\n") {
+				fmt.Fprintf(bw, "%s=%s\n", key, val)
+				continue
+			}
+			delim, err := heredocDelimiter(val)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "%s<<%s\n%s\n%s\n", key, delim, val, delim)
+		}
+	default:
+		return fmt.Errorf("unknown env format %d", format)
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the variables to the file at path, see Write.
+// The file is truncated, except for GithubEnvFormat which appends to it
+// as the file is shared by all steps of a job.
+func (e *EnvSet) WriteFile(path string, format EnvFormat, keys ...string) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if format == GithubEnvFormat {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if err = e.Write(f, format, keys...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dotenvQuote returns val as is if Load reads it back unchanged, or double quoted otherwise
+func dotenvQuote(val string) string {
+	plain := true
+	for i := 0; i < len(val) && plain; i++ {
+		plain = isNameChar(val[i]) || strings.IndexByte("-./:,@%+~^", val[i]) >= 0
+	}
+	if plain {
+		return val
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(val) + `"`
+}
+
+// shellQuote single quotes val for POSIX shells
+func shellQuote(val string) string {
+	return "'" + strings.Replace(val, "'", `'\''`, -1) + "'"
+}
+
+// heredocDelimiter returns a random delimiter not occurring in val
+func heredocDelimiter(val string) (string, error) {
+	for {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		if delim := "ghadelimiter_" + hex.EncodeToString(b); !strings.Contains(val, delim) {
+			return delim, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestPromote(t *testing.T) {
+	defer os.Unsetenv("_RUN_PROMOTE_A")
+	defer os.Unsetenv("_RUN_PROMOTE_B")
+	env := newGlobalEnv("_RUN_PROMOTE_A=a", "_RUN_PROMOTE_B=b")
+
+	assert.NoError(t, env.Promote("_RUN_PROMOTE_B"))
+	assert.Equal(t, "", os.Getenv("_RUN_PROMOTE_A"))
+	assert.Equal(t, "b", os.Getenv("_RUN_PROMOTE_B"))
+
+	assert.NoError(t, env.Promote())
+	assert.Equal(t, "a", os.Getenv("_RUN_PROMOTE_A"), "All variables above the process layer should be promoted")
+	assert.Equal(t, "process", env.Explain("HOME"))
+	assert.Error(t, env.Promote("_RUN_PROMOTE_UNSET"))
+}
+
+func TestWriteEnv(t *testing.T) {
+	env, _ := NewEnv("PLAIN=./bin:/usr/bin", "EMPTY=")
+	env.put("QUOTED", "it's a \"$test\"")
+	env.put("LINES", "a\nb")
+
+	var output bytes.Buffer
+	assert.NoError(t, env.Write(&output, DotenvFormat))
+	assert.Equal(t, "PLAIN=./bin:/usr/bin\nEMPTY=\nQUOTED=\"it's a \\\"\\$test\\\"\"\nLINES=\"a\\nb\"\n", output.String())
+	loaded, _ := NewEnv()
+	assert.NoError(t, loaded.parseDotenv(output.String()))
+	assert.Equal(t, env.List(), loaded.List(), "Dotenv output should load back unchanged")
+
+	output.Reset()
+	assert.NoError(t, env.Write(&output, ShellFormat, "QUOTED", "PLAIN"))
+	assert.Equal(t, "export QUOTED='it'\\''s a \"$test\"'\nexport PLAIN='./bin:/usr/bin'\n", output.String())
+
+	output.Reset()
+	assert.NoError(t, env.Write(&output, JSONFormat))
+	assert.True(t, strings.HasPrefix(output.String(), "{\n  \"PLAIN\": "), "JSON should keep the order: "+output.String())
+	var obj map[string]string
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &obj))
+	assert.Equal(t, "a\nb", obj["LINES"])
+
+	output.Reset()
+	assert.NoError(t, env.Write(&output, GithubEnvFormat, "PLAIN", "LINES"))
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal(t, 6, len(lines))
+	assert.Equal(t, "PLAIN=./bin:/usr/bin", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "LINES<<ghadelimiter_"))
+	assert.Equal(t, lines[1][len("LINES<<"):], lines[4], "Heredoc should be closed by its delimiter")
+
+	assert.Error(t, env.Write(&output, JSONFormat, "UNSET"))
+	assert.Error(t, env.Write(&output, EnvFormat(-1)))
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	env, _ := NewEnv("FOO=foo")
+
+	path := filepath.Join(dir, "github_env")
+	assert.NoError(t, env.WriteFile(path, GithubEnvFormat))
+	assert.NoError(t, env.WriteFile(path, GithubEnvFormat))
+	out, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "FOO=foo\nFOO=foo\n", string(out), "GitHub env files should be appended to")
+
+	path = filepath.Join(dir, ".env")
+	assert.NoError(t, env.WriteFile(path, DotenvFormat))
+	assert.NoError(t, env.WriteFile(path, DotenvFormat))
+	out, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "FOO=foo\n", string(out))
+}
@@ -0,0 +1,219 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SourceCache is the path of the content hash cache used by Sources.
+// If set, sources are compared by content with the last successful run
+// instead of by modification time, for when mtimes are unreliable,
+// like fresh git checkouts or restored CI caches.
+var SourceCache = ""
+
+// guard is the Runnable returned by Sources and Targets,
+// it skips the preceding chain if the targets are up to date
+type guard struct {
+	runner
+	chain   Runnable
+	sources []string
+	targets []string
+}
+
+func newGuard(chain Runnable, sources, targets []string) *guard {
+	g := &guard{chain: chain, sources: sources, targets: targets}
+	g.runner = g.run
+	return g
+}
+
+// Sources implements Runnable interface, adding to the sources of the guard
+func (g *guard) Sources(globs ...string) Runnable {
+	return newGuard(g.chain, append(append([]string(nil), g.sources...), globs...), g.targets)
+}
+
+// Targets implements Runnable interface, adding to the targets of the guard
+func (g *guard) Targets(globs ...string) Runnable {
+	return newGuard(g.chain, g.sources, append(append([]string(nil), g.targets...), globs...))
+}
+
+func (g *guard) run() error {
+	sources, err := globFiles(g.sources)
+	if err != nil {
+		return err
+	}
+	targets, err := globFiles(g.targets)
+	if err != nil {
+		return err
+	}
+	var key, sum string
+	if SourceCache != "" {
+		key = g.cacheKey()
+		if sum, err = hashFiles(sources); err != nil {
+			return err
+		}
+	}
+	if g.upToDate(sources, targets, key, sum) {
+		logger.Log(EventChainSkipped, "sources", g.sources, "targets", g.targets)
+		return nil
+	}
+	if g.chain != nil {
+		if err = g.chain.Run(); err != nil {
+			return err
+		}
+	}
+	if SourceCache != "" {
+		return storeSourceHash(key, sum)
+	}
+	return nil
+}
+
+// upToDate reports whether all source and target patterns match existing files, and
+// either all targets are newer than all sources, or with SourceCache the
+// sources did not change since the last successful run.
+// A source pattern matching nothing, like a typo or a file not generated yet,
+// makes the chain run rather than be skipped for good.
+func (g *guard) upToDate(sources, targets []string, key, sum string) bool {
+	for _, p := range append(append([]string(nil), g.sources...), g.targets...) {
+		if matches, _ := globFiles([]string{p}); len(matches) == 0 {
+			return false
+		}
+	}
+	if SourceCache != "" {
+		return loadSourceHashes()[key] == sum
+	}
+	if len(g.targets) == 0 {
+		return false
+	}
+	var newest time.Time
+	for _, s := range sources {
+		if fi, err := os.Stat(s); err != nil {
+			return false
+		} else if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	for _, t := range targets {
+		if fi, err := os.Stat(t); err != nil || !fi.ModTime().After(newest) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheKey identifies the guard by its directory and patterns
+func (g *guard) cacheKey() string {
+	dir, _ := filepath.Abs(workingDir)
+	h := sha256.New()
+	io.WriteString(h, dir)
+	for _, p := range g.sources {
+		io.WriteString(h, "\x00s"+p)
+	}
+	for _, p := range g.targets {
+		io.WriteString(h, "\x00t"+p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFiles returns the hash of the names and contents of the files
+func hashFiles(files []string) (string, error) {
+	h := sha256.New()
+	for _, f := range files {
+		r, err := os.Open(f)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, filepath.ToSlash(f)+"\x00")
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadSourceHashes reads SourceCache, a missing or corrupt cache is empty
+func loadSourceHashes() map[string]string {
+	hashes := make(map[string]string)
+	if src, err := ioutil.ReadFile(SourceCache); err == nil {
+		json.Unmarshal(src, &hashes)
+	}
+	return hashes
+}
+
+func storeSourceHash(key, sum string) error {
+	hashes := loadSourceHashes()
+	hashes[key] = sum
+	src, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(SourceCache); dir != "." {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(SourceCache, src, 0644)
+}
+
+// globFiles returns the sorted regular files matching the patterns, relative to workingDir.
+// Besides the filepath.Match syntax a "**" path element matches any number of directories.
+func globFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, p := range patterns {
+		if !filepath.IsAbs(p) && workingDir != "" {
+			p = filepath.Join(workingDir, p)
+		}
+		matches, err := glob(filepath.ToSlash(filepath.Clean(p)))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.Mode().IsRegular() && !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// glob expands a slash separated pattern, which may contain "**" elements
+func glob(pattern string) ([]string, error) {
+	i := strings.Index(pattern, "**")
+	if i < 0 {
+		return filepath.Glob(filepath.FromSlash(pattern))
+	}
+	root, rest := strings.TrimSuffix(pattern[:i], "/"), strings.TrimPrefix(pattern[i+2:], "/")
+	if rest == "" {
+		rest = "*"
+	}
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	var matches []string
+	err := filepath.Walk(filepath.FromSlash(root), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		sub, err := glob(strings.TrimSuffix(filepath.ToSlash(path), "/") + "/" + rest)
+		matches = append(matches, sub...)
+		return err
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return matches, err
+}
@@ -0,0 +1,145 @@
+package run
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestGlobFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"a.proto", "api/b.proto", "api/v1/c.proto", "api/v1/c.txt"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, f), nil, 0644)
+	}
+	old := workingDir
+	defer func() {
+		workingDir = old
+	}()
+	workingDir = dir
+
+	rel := func(files []string) (r []string) {
+		for _, f := range files {
+			p, _ := filepath.Rel(dir, f)
+			r = append(r, filepath.ToSlash(p))
+		}
+		return
+	}
+	files, err := globFiles([]string{"*.proto"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.proto"}, rel(files))
+
+	files, _ = globFiles([]string{"**/*.proto"})
+	assert.Equal(t, []string{"a.proto", "api/b.proto", "api/v1/c.proto"}, rel(files))
+
+	files, _ = globFiles([]string{"api/**", "api/*.proto"})
+	assert.Equal(t, []string{"api/b.proto", "api/v1/c.proto", "api/v1/c.txt"}, rel(files), "Matches should be unique")
+
+	files, _ = globFiles([]string{"missing/**/*.proto", "api"})
+	assert.Equal(t, 0, len(files), "Directories should not match")
+}
+
+func TestSourcesTargets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src, out := filepath.Join(dir, "src.txt"), filepath.Join(dir, "out.txt")
+	ioutil.WriteFile(src, []byte("v1"), 0644)
+
+	runs := 0
+	gen := func() Runnable {
+		return runner(func() error {
+			runs++
+			return Shell(`cp src.txt out.txt`).Run()
+		}).Sources("src.txt").Targets("out.txt").At(dir)
+	}
+
+	assert.NoError(t, gen().Run())
+	assert.Equal(t, 1, runs, "Missing targets should run the chain")
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(src, past, past)
+	assert.NoError(t, gen().Run())
+	assert.Equal(t, 1, runs, "Newer targets should skip the chain")
+
+	os.Chtimes(src, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	assert.NoError(t, gen().Run())
+	assert.Equal(t, 2, runs, "Newer sources should run the chain")
+
+	os.Remove(out)
+	runs = 0
+	runner(func() error {
+		runs++
+		return nil
+	}).Sources(src).Run()
+	assert.Equal(t, 1, runs, "Chains without targets should always run by mtime")
+
+	ioutil.WriteFile(out, []byte("v1"), 0644)
+	runs = 0
+	typo := runner(func() error {
+		runs++
+		return nil
+	}).Sources("src.txt", "scr/*.txt").Targets("out.txt").At(dir)
+	assert.NoError(t, typo.Run())
+	assert.NoError(t, typo.Run())
+	assert.Equal(t, 2, runs, "Source patterns matching nothing should run the chain")
+	SourceCache = filepath.Join(dir, "cache.json")
+	defer func() {
+		SourceCache = ""
+	}()
+	assert.NoError(t, typo.Run())
+	assert.NoError(t, typo.Run())
+	assert.Equal(t, 4, runs, "Source patterns matching nothing should run the chain with the cache")
+}
+
+func TestSourceCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.txt")
+	ioutil.WriteFile(src, []byte("v1"), 0644)
+
+	defer func() {
+		SourceCache = ""
+	}()
+	SourceCache = filepath.Join(dir, "cache", "sources.json")
+
+	runs := 0
+	fail := false
+	count := runner(func() error {
+		runs++
+		if fail {
+			return os.ErrInvalid
+		}
+		return nil
+	})
+	gen := count.Sources("*.txt").At(dir)
+
+	assert.NoError(t, gen.Run())
+	assert.NoError(t, gen.Run())
+	assert.Equal(t, 1, runs, "Unchanged sources should skip the chain")
+
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(src, future, future)
+	assert.NoError(t, gen.Run())
+	assert.Equal(t, 1, runs, "Modification times should be ignored")
+
+	ioutil.WriteFile(src, []byte("v2"), 0644)
+	fail = true
+	assert.Error(t, gen.Run())
+	fail = false
+	assert.NoError(t, gen.Run())
+	assert.Equal(t, 3, runs, "Failed runs should not be cached")
+
+	assert.NoError(t, count.Sources("*.txt").Targets("missing").At(dir).Run())
+	assert.Equal(t, 4, runs, "Missing targets should run the chain")
+}
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"errors"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned when hidden input is interrupted with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// Hidden asks for input without showing it, like a password.
+// On a terminal the input is not echoed. Otherwise, like a piped stdin or a test reader,
+// a line is read as is.
+func (p *Prompter) Hidden(q Question) (string, error) {
+	return p.answer(q, q.Prompt, func() (string, error) {
+		return p.readSecret("")
+	}, func(string) error {
+		return nil
+	})
+}
+
+// Masked works like Hidden and echoes a "*" for each character typed on a terminal
+func (p *Prompter) Masked(q Question) (string, error) {
+	return p.answer(q, q.Prompt, func() (string, error) {
+		return p.readSecret("*")
+	}, func(string) error {
+		return nil
+	})
+}
+
+// readSecret reads a line from the terminal without echo, or from other inputs as is
+func (p *Prompter) readSecret(mask string) (string, error) {
+	if f, ok := p.in().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return readTerminal(f, p.out(), mask)
+	}
+	return p.readLine()
+}
+
+// readTerminal reads a line from the terminal f in raw mode, writing mask to out for each character
+func readTerminal(f *os.File, out io.Writer, mask string) (string, error) {
+	state, err := term.MakeRaw(int(f.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(int(f.Fd()), state)
+
+	var input []byte
+	b := make([]byte, 1)
+	for {
+		n, err := f.Read(b)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			continue
+		}
+		switch c := b[0]; {
+		case c == '\r' || c == '\n':
+			// raw mode does not translate newlines
+			io.WriteString(out, "\r\n")
+			return string(input), nil
+		case c == 3: // Ctrl-C
+			io.WriteString(out, "\r\n")
+			return "", ErrInterrupted
+		case c == 4: // Ctrl-D
+			if len(input) == 0 {
+				return "", io.EOF
+			}
+		case c == 8 || c == 127: // backspace
+			if len(input) > 0 {
+				_, size := utf8.DecodeLastRune(input)
+				input = input[:len(input)-size]
+				if mask != "" {
+					io.WriteString(out, "\b \b")
+				}
+			}
+		case c >= ' ':
+			input = append(input, c)
+			// a single mask per character, on its first byte
+			if mask != "" && utf8.RuneStart(c) {
+				io.WriteString(out, mask)
+			}
+		}
+	}
+}
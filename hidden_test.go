@@ -0,0 +1,49 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestPrompterHidden(t *testing.T) {
+	var out bytes.Buffer
+	p := &Prompter{In: strings.NewReader("s3cr3t pass\n\n"), Out: &out}
+	s, err := p.Hidden(Question{Prompt: "Password: "})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t pass", s, "Input which is not a terminal should be read as a line")
+	s, err = p.Masked(Question{Prompt: "Token: ", Validate: func(s string) error {
+		if s == "" {
+			return errors.New("required")
+		}
+		return nil
+	}})
+	assert.True(t, errors.Is(err, ErrNoAnswer), "The end of input should fail instead of hanging")
+	assert.Equal(t, "Password: Token: required\nToken: \n", out.String(), "Input should not be shown")
+
+	Env.Set("ANSWER_TOKEN=abc")
+	defer Env.Unset("ANSWER_TOKEN")
+	p = &Prompter{Answers: EnvAnswers("ANSWER_"), NonInteractive: true}
+	s, err = p.Masked(Question{Name: "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", s)
+}
+
+func TestPromptHidden(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdin := os.Stdin
+	defer func() {
+		os.Stdin = stdin
+	}()
+	os.Stdin = r
+	w.WriteString("hidden\nmasked\n")
+	w.Close()
+	assert.Equal(t, "hidden", PromptHidden(""), "Piped stdin should be read")
+	assert.Equal(t, "masked", PromptMasked(""))
+	assert.Equal(t, "", PromptMasked(""), "The end of input should not block")
+}
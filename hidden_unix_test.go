@@ -0,0 +1,56 @@
+//go:build !windows
+// +build !windows
+
+package run
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+func TestPrompterHiddenTerminal(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	assert.NoError(t, err)
+	defer ptmx.Close()
+	defer tty.Close()
+
+	// the input is typed once the prompt switched the terminal to raw mode,
+	// the line discipline would handle erase and interrupt characters before
+	cooked, err := term.GetState(int(tty.Fd()))
+	assert.NoError(t, err)
+	typing := func(s string) {
+		go func() {
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				if state, err := term.GetState(int(tty.Fd())); err == nil && *state != *cooked {
+					break
+				}
+			}
+			ptmx.Write([]byte(s))
+		}()
+	}
+	var out bytes.Buffer
+	p := &Prompter{In: tty, Out: &out}
+	typing("pass\r")
+	s, err := p.Hidden(Question{Prompt: "Password: "})
+	assert.NoError(t, err)
+	assert.Equal(t, "pass", s)
+	assert.Equal(t, "Password: \r\n", out.String(), "Hidden input should not be echoed")
+
+	out.Reset()
+	typing("pé\x7fwx\x7fd\r")
+	s, err = p.Masked(Question{Prompt: "Token: "})
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", s, "Backspace should erase characters")
+	assert.Equal(t, "Token: **\b \b**\b \b*\r\n", out.String())
+
+	out.Reset()
+	typing("ab\x03")
+	_, err = p.Masked(Question{Prompt: "Token: "})
+	assert.True(t, errors.Is(err, ErrInterrupted), err)
+}
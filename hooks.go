@@ -0,0 +1,155 @@
+package run
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Process describes a command passed to Hooks, secret values are redacted
+type Process struct {
+	// Cmd is the command line
+	Cmd string
+	// Bin is the resolved path of the binary
+	Bin  string
+	Args []string
+	// Env is the complete environment of the process
+	Env []string
+	Dir string
+	// Async reports commands run by Start
+	Async bool
+	// Pid is set once the process started
+	Pid int
+	// Started is the time the process started
+	Started time.Time
+}
+
+// Hooks are called around the execution of every command, any of them may be nil.
+// Hooks of async commands are called from other goroutines.
+type Hooks struct {
+	// BeforeRun is called before the process starts, an error aborts the command
+	BeforeRun func(p *Process) error
+	// AfterStart is called once the process started
+	AfterStart func(p *Process)
+	// OnOutputLine is called with each line written by the process to stream, Stdout or Stderr,
+	// without the line ending
+	OnOutputLine func(p *Process, stream int, line string)
+	// OnExit is called once the process exited, with its exit code and run time
+	OnExit func(p *Process, code int, elapsed time.Duration)
+	// OnError is called if the command fails, including non zero exit codes
+	OnError func(p *Process, err error)
+}
+
+// globalHooks are the hooks registered by AddHooks
+var globalHooks struct {
+	sync.Mutex
+	list []*Hooks
+}
+
+// chainHooks are the hooks set by WithHooks for the running chain
+var chainHooks []Hooks
+
+// AddHooks registers hooks for all commands, it returns a function removing them
+func AddHooks(h Hooks) (remove func()) {
+	globalHooks.Lock()
+	defer globalHooks.Unlock()
+	p := &h
+	globalHooks.list = append(globalHooks.list, p)
+	return func() {
+		globalHooks.Lock()
+		defer globalHooks.Unlock()
+		for i, g := range globalHooks.list {
+			if g == p {
+				globalHooks.list = append(globalHooks.list[:i:i], globalHooks.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// activeHooks returns the global hooks followed by the hooks of the chain
+func activeHooks() (hooks []Hooks) {
+	globalHooks.Lock()
+	for _, h := range globalHooks.list {
+		hooks = append(hooks, *h)
+	}
+	globalHooks.Unlock()
+	return append(hooks, chainHooks...)
+}
+
+// process returns the description of the command for the hooks
+func (a *app) process(cmd *exec.Cmd, async bool) *Process {
+	p := &Process{Cmd: a.redact(a.cmd), Bin: a.bin, Dir: a.dir, Async: async}
+	args := a.arg
+	if cmd != nil {
+		p.Bin, args, p.Dir = cmd.Path, cmd.Args[1:], cmd.Dir
+		for _, kv := range cmd.Env {
+			p.Env = append(p.Env, a.redact(kv))
+		}
+	}
+	for _, arg := range args {
+		p.Args = append(p.Args, a.redact(arg))
+	}
+	return p
+}
+
+// lineWriter calls the OnOutputLine hooks for each line written through it
+type lineWriter struct {
+	sync.Mutex
+	w      io.Writer
+	app    *app
+	stream int
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.emit(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return l.w.Write(p)
+}
+
+// Close reports the pending incomplete line
+func (l *lineWriter) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.buf) > 0 {
+		l.emit(string(l.buf))
+		l.buf = nil
+	}
+	return nil
+}
+
+func (l *lineWriter) emit(line string) {
+	line = l.app.redact(strings.TrimSuffix(line, "\r"))
+	for _, h := range l.app.hooks {
+		if h.OnOutputLine != nil {
+			h.OnOutputLine(l.app.startedProc(), l.stream, line)
+		}
+	}
+}
+
+func withHooks(h Hooks, run Runnable) Runnable {
+	return runner(func() error {
+		old := chainHooks
+		defer func() {
+			chainHooks = old
+		}()
+		chainHooks = append(append([]Hooks(nil), old...), h)
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
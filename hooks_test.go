@@ -0,0 +1,122 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+// hookRecorder records the calls of its hooks
+type hookRecorder struct {
+	sync.Mutex
+	calls []string
+	procs []*Process
+	lines []string
+	veto  error
+}
+
+func (r *hookRecorder) hooks() Hooks {
+	record := func(call string, p *Process) {
+		r.Lock()
+		defer r.Unlock()
+		r.calls = append(r.calls, call)
+		r.procs = append(r.procs, p)
+	}
+	return Hooks{
+		BeforeRun: func(p *Process) error {
+			record("before", p)
+			return r.veto
+		},
+		AfterStart: func(p *Process) {
+			record("start", p)
+		},
+		OnOutputLine: func(p *Process, stream int, line string) {
+			r.Lock()
+			defer r.Unlock()
+			r.lines = append(r.lines, map[int]string{Stdout: "out", Stderr: "err"}[stream]+":"+line)
+		},
+		OnExit: func(p *Process, code int, elapsed time.Duration) {
+			record("exit", p)
+		},
+		OnError: func(p *Process, err error) {
+			record("error:"+err.Error(), p)
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var rec hookRecorder
+	var output bytes.Buffer
+	err := Shell(`echo one; echo $TOKEN >&2; printf two`).At("test").WithSecret("TOKEN=s3cr3t").WithHooks(rec.hooks()).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "one\ntwo", output.String(), "Output should still be written")
+
+	assert.Equal(t, []string{"before", "start", "exit"}, rec.calls)
+	var stdout []string
+	for _, l := range rec.lines {
+		if strings.HasPrefix(l, "out:") {
+			stdout = append(stdout, l)
+		}
+	}
+	assert.Equal(t, []string{"out:one", "out:two"}, stdout)
+	assert.Equal(t, 3, len(rec.lines))
+	assert.True(t, rec.lines[0] == "err:***" || rec.lines[1] == "err:***", "Secrets should be redacted from lines")
+	p := rec.procs[0]
+	assert.True(t, strings.HasSuffix(p.Bin, "/sh"), p.Bin)
+	assert.Equal(t, "test", p.Dir)
+	assert.True(t, p.Pid > 0)
+	assert.False(t, p.Started.IsZero())
+	var env string
+	for _, kv := range p.Env {
+		if strings.HasPrefix(kv, "TOKEN=") {
+			env = kv
+		}
+	}
+	assert.Equal(t, "TOKEN=***", env, "Secrets should be redacted")
+
+	rec = hookRecorder{}
+	assert.Error(t, Shell(`exit 1`).WithHooks(rec.hooks()).Run())
+	assert.Equal(t, []string{"before", "start", "exit", "error:exit status 1"}, rec.calls)
+
+	rec = hookRecorder{veto: errors.New("denied")}
+	err = Call("true").WithHooks(rec.hooks()).Run()
+	assert.Error(t, err, "BeforeRun should abort the command")
+	assert.Equal(t, []string{"before", "error:denied"}, rec.calls)
+
+	rec = hookRecorder{}
+	Call("doesnotexist").WithHooks(rec.hooks()).Run()
+	assert.Equal(t, 1, len(rec.calls), "Commands not found should be reported")
+	assert.True(t, strings.HasPrefix(rec.calls[0], "error:"))
+
+	rec = hookRecorder{}
+	Call("true").Run()
+	assert.Equal(t, 0, len(rec.calls), "Chain hooks should be reset after the chain")
+}
+
+func TestGlobalHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var global, chain hookRecorder
+	remove := AddHooks(global.hooks())
+
+	Start("sleep 0").WithHooks(chain.hooks()).Run()
+	Wait()
+	Shell(BuiltinShell, `printf builtin`).Pipe(Stdout, &bytes.Buffer{}).Run()
+	remove()
+	Call("true").Run()
+
+	assert.Equal(t, []string{"before", "start", "exit", "before", "start", "exit"}, global.calls)
+	assert.Equal(t, []string{"before", "start", "exit"}, chain.calls)
+	assert.True(t, global.procs[0].Async)
+	assert.Equal(t, []string{"out:builtin"}, global.lines, "Builtin shell commands should be hooked")
+}
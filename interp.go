@@ -0,0 +1,985 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BuiltinShell selects the in-process POSIX sh interpreter as Shell backend.
+// It supports variables, pipes, redirections, `&&`/`||` lists and the builtins
+// cd, pwd, echo, export, unset, set, shift, exit, true and false.
+// All other commands are run as binaries through the same path as Call, so
+// scripts honor Env, With and At without requiring a shell on the host.
+// Control structures, subshells, command substitution and background jobs
+// are not supported.
+const BuiltinShell = "builtin"
+
+const (
+	tokWord = iota
+	tokOp
+	tokEOF
+)
+
+// wordPart is a segment of a word sharing the same quoting
+type wordPart struct {
+	text string
+	// quoted parts are neither field split nor globbed
+	quoted bool
+	// literal parts are not subject to parameter expansion
+	literal bool
+}
+
+type word []wordPart
+
+type token struct {
+	kind int
+	op   string
+	word word
+}
+
+type redirect struct {
+	op     string
+	target word
+}
+
+type command struct {
+	assigns []word
+	args    []word
+	redirs  []redirect
+}
+
+type pipeline struct {
+	negate bool
+	cmds   []command
+}
+
+type andOr struct {
+	pipes []pipeline
+	// operators between pipes, "&&" or "||"
+	ops []string
+}
+
+// operators sorted by length so that the longest match wins
+var shellOps = []string{"&&", "||", ">>", ">&", "<&", "&>", ";", "\n", "|", "&", ">", "<"}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) operator() string {
+	for _, op := range shellOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		if c := l.src[l.pos]; c == ' ' || c == '\t' || c == '\r' {
+			l.pos++
+		} else if c == '\\' && l.peek(1) == '\n' {
+			l.pos += 2
+		} else if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		} else {
+			break
+		}
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF}, nil
+	}
+	// io number prefixing a redirection, e.g. 2>&1
+	if c := l.src[l.pos]; c >= '0' && c <= '9' && (l.peek(1) == '>' || l.peek(1) == '<') {
+		l.pos++
+		op := l.operator()
+		l.pos += len(op)
+		return token{kind: tokOp, op: string(c) + op}, nil
+	}
+	if op := l.operator(); op != "" {
+		l.pos += len(op)
+		return token{kind: tokOp, op: op}, nil
+	}
+	return l.word()
+}
+
+func (l *lexer) word() (token, error) {
+	var w word
+	add := func(s string, quoted, literal bool) {
+		if n := len(w); n > 0 && w[n-1].quoted == quoted && w[n-1].literal == literal {
+			w[n-1].text += s
+		} else {
+			w = append(w, wordPart{s, quoted, literal})
+		}
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || l.operator() != "":
+			return token{kind: tokWord, word: w}, nil
+		case c == '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end < 0 {
+				return token{}, fmt.Errorf("unterminated quoted string")
+			}
+			add(l.src[l.pos+1:l.pos+1+end], true, true)
+			l.pos += end + 2
+		case c == '"':
+			l.pos++
+			for {
+				if l.pos >= len(l.src) {
+					return token{}, fmt.Errorf("unterminated quoted string")
+				}
+				c = l.src[l.pos]
+				if c == '"' {
+					l.pos++
+					break
+				}
+				if c == '\\' && strings.IndexByte("$`\"\\\n", l.peek(1)) >= 0 && l.peek(1) != 0 {
+					if l.peek(1) != '\n' {
+						add(string(l.peek(1)), true, true)
+					}
+					l.pos += 2
+					continue
+				}
+				add(string(c), true, false)
+				l.pos++
+			}
+			// keep empty quoted strings as an (empty) field
+			add("", true, true)
+		case c == '\\':
+			if l.peek(1) != '\n' && l.peek(1) != 0 {
+				add(string(l.peek(1)), true, true)
+			}
+			l.pos += 2
+		case c == '$' && l.peek(1) == '(':
+			return token{}, fmt.Errorf("command substitution is not supported")
+		case c == '$' && l.peek(1) == '{':
+			end := matchBrace(l.src[l.pos:], 1)
+			if end < 0 {
+				return token{}, fmt.Errorf("bad substitution")
+			}
+			add(l.src[l.pos:l.pos+end+1], false, false)
+			l.pos += end + 1
+		case c == '`':
+			return token{}, fmt.Errorf("command substitution is not supported")
+		default:
+			add(string(c), false, false)
+			l.pos++
+		}
+	}
+	return token{kind: tokWord, word: w}, nil
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// parseScript parses the script into a list of and-or lists
+func parseScript(src string) ([]andOr, error) {
+	p := &parser{lex: &lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p.list()
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lex.next()
+	return
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokOp && p.tok.op == op
+}
+
+func (p *parser) skipNewlines() error {
+	for p.is("\n") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) list() (list []andOr, err error) {
+	for {
+		for p.is(";") || p.is("\n") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.kind == tokEOF {
+			return list, nil
+		}
+		ao, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ao)
+		switch {
+		case p.tok.kind == tokEOF, p.is(";"), p.is("\n"):
+		case p.is("&"):
+			return nil, fmt.Errorf("background jobs are not supported")
+		default:
+			return nil, fmt.Errorf("syntax error near unexpected token %q", p.tok.op)
+		}
+	}
+}
+
+func (p *parser) andOr() (ao andOr, err error) {
+	pl, err := p.pipeline()
+	if err != nil {
+		return
+	}
+	ao.pipes = append(ao.pipes, pl)
+	for p.is("&&") || p.is("||") {
+		ao.ops = append(ao.ops, p.tok.op)
+		if err = p.advance(); err != nil {
+			return
+		}
+		if err = p.skipNewlines(); err != nil {
+			return
+		}
+		if pl, err = p.pipeline(); err != nil {
+			return
+		}
+		ao.pipes = append(ao.pipes, pl)
+	}
+	return
+}
+
+func (p *parser) pipeline() (pl pipeline, err error) {
+	if p.tok.kind == tokWord && len(p.tok.word) == 1 && p.tok.word[0].text == "!" && !p.tok.word[0].quoted {
+		pl.negate = true
+		if err = p.advance(); err != nil {
+			return
+		}
+	}
+	for {
+		c, err := p.command()
+		if err != nil {
+			return pl, err
+		}
+		pl.cmds = append(pl.cmds, c)
+		if !p.is("|") {
+			return pl, nil
+		}
+		if err = p.advance(); err != nil {
+			return pl, err
+		}
+		if err = p.skipNewlines(); err != nil {
+			return pl, err
+		}
+	}
+}
+
+func (p *parser) command() (c command, err error) {
+	for {
+		switch {
+		case p.tok.kind == tokWord:
+			if len(c.args) == 0 && isAssignment(p.tok.word) {
+				c.assigns = append(c.assigns, p.tok.word)
+			} else {
+				c.args = append(c.args, p.tok.word)
+			}
+		case p.tok.kind == tokOp && strings.ContainsAny(p.tok.op, "<>"):
+			r := redirect{op: p.tok.op}
+			if err = p.advance(); err != nil {
+				return
+			}
+			if p.tok.kind != tokWord {
+				return c, fmt.Errorf("missing target for redirection %q", r.op)
+			}
+			r.target = p.tok.word
+			c.redirs = append(c.redirs, r)
+		default:
+			if len(c.assigns)+len(c.args)+len(c.redirs) == 0 {
+				if p.tok.kind == tokEOF {
+					return c, fmt.Errorf("syntax error: unexpected end of script")
+				}
+				return c, fmt.Errorf("syntax error near unexpected token %q", p.tok.op)
+			}
+			return c, nil
+		}
+		if err = p.advance(); err != nil {
+			return
+		}
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAssignment(w word) bool {
+	if len(w) == 0 || w[0].quoted {
+		return false
+	}
+	i := strings.IndexByte(w[0].text, '=')
+	return i > 0 && isName(w[0].text[:i])
+}
+
+// exitStatus is the error returned by the interpreter for a non-zero exit status
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+type stdio struct {
+	in       io.Reader
+	out, err io.Writer
+}
+
+// interp is the state of a running builtin shell
+type interp struct {
+	vars     map[string]string
+	exported map[string]bool
+	dir      string
+	// positional parameters, including $0
+	args   []string
+	flags  ShellFlag
+	status int
+	exited bool
+}
+
+// newInterp returns an interpreter with the app environment in the given directory
+func newInterp(conf ShellConfig, dir string) (*interp, error) {
+	sh := &interp{
+		vars:     make(map[string]string),
+		exported: make(map[string]bool),
+		args:     append([]string{BuiltinShell}, conf.Args...),
+		flags:    conf.Flags,
+	}
+	env, err := (&app{}).scope()
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range env.List() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			sh.vars[kv[:i]] = kv[i+1:]
+			sh.exported[kv[:i]] = true
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		dir = wd
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(wd, dir)
+	}
+	sh.dir = dir
+	return sh, nil
+}
+
+// run interprets the script with the process standard streams
+func (sh *interp) run(script string) error {
+	list, err := parseScript(script)
+	if err != nil {
+		return fmt.Errorf("%s: %v", BuiltinShell, err)
+	}
+	logger.Log(EventCommandLoaded, "cmd", redact(script), "path", BuiltinShell, "dir", sh.dir)
+	sh.list(list, stdio{os.Stdin, os.Stdout, os.Stderr})
+	if sh.status != 0 {
+		return exitStatus(sh.status)
+	}
+	return nil
+}
+
+// subshell returns a copy of the interpreter for pipeline stages
+func (sh *interp) subshell() *interp {
+	sub := *sh
+	// shift and set -- must not change the positional parameters of the parent
+	sub.args = append([]string(nil), sh.args...)
+	sub.vars = make(map[string]string, len(sh.vars))
+	sub.exported = make(map[string]bool, len(sh.exported))
+	for k, v := range sh.vars {
+		sub.vars[k] = v
+	}
+	for k, v := range sh.exported {
+		sub.exported[k] = v
+	}
+	return &sub
+}
+
+func (sh *interp) list(list []andOr, std stdio) {
+	for _, ao := range list {
+		if sh.exited {
+			return
+		}
+		if checked := sh.andOr(ao, std); checked && sh.status != 0 && sh.flags&Errexit > 0 {
+			sh.exited = true
+		}
+	}
+}
+
+// andOr runs the and-or list and reports whether its status is subject to errexit
+func (sh *interp) andOr(ao andOr, std stdio) bool {
+	sh.status = sh.pipeline(ao.pipes[0], std)
+	last := 0
+	for i, op := range ao.ops {
+		if sh.exited {
+			return false
+		}
+		if (op == "&&") == (sh.status == 0) {
+			sh.status = sh.pipeline(ao.pipes[i+1], std)
+			last = i + 1
+		}
+	}
+	return last == len(ao.pipes)-1 && !ao.pipes[last].negate
+}
+
+func (sh *interp) pipeline(pl pipeline, std stdio) int {
+	status := sh.pipe(pl.cmds, std)
+	if pl.negate {
+		if status == 0 {
+			return 1
+		}
+		return 0
+	}
+	return status
+}
+
+// pipe runs the commands concurrently with the output of each connected to the input of the next
+func (sh *interp) pipe(cmds []command, std stdio) int {
+	if len(cmds) == 1 {
+		return sh.command(cmds[0], std)
+	}
+	status := make([]int, len(cmds))
+	var wg sync.WaitGroup
+	in := std.in
+	for i, c := range cmds {
+		st := stdio{in, std.out, std.err}
+		var r, w *os.File
+		if i < len(cmds)-1 {
+			var err error
+			if r, w, err = os.Pipe(); err != nil {
+				fmt.Fprintf(std.err, "%s: %v\n", BuiltinShell, err)
+				wg.Wait()
+				return 1
+			}
+			st.out = w
+		}
+		wg.Add(1)
+		go func(i int, c command, st stdio, w *os.File) {
+			defer wg.Done()
+			status[i] = sh.subshell().command(c, st)
+			if w != nil {
+				w.Close()
+			}
+			if r, ok := st.in.(*os.File); ok && i > 0 {
+				r.Close()
+			}
+		}(i, c, st, w)
+		in = r
+	}
+	wg.Wait()
+	if sh.flags&Pipefail > 0 {
+		for i := len(status) - 1; i >= 0; i-- {
+			if status[i] != 0 {
+				return status[i]
+			}
+		}
+	}
+	return status[len(status)-1]
+}
+
+func (sh *interp) command(c command, std stdio) int {
+	args, err := sh.fields(c.args)
+	if err != nil {
+		return sh.fatal(std, err)
+	}
+	var assigns []string
+	for _, w := range c.assigns {
+		kv, err := sh.expandWord(w)
+		if err != nil {
+			return sh.fatal(std, err)
+		}
+		assigns = append(assigns, kv)
+	}
+	std, files, err := sh.redirect(c.redirs, std)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if err != nil {
+		fmt.Fprintf(std.err, "%s: %v\n", BuiltinShell, err)
+		return 1
+	}
+	if len(args) == 0 {
+		for _, kv := range assigns {
+			sh.set(kv, false)
+		}
+		return 0
+	}
+	if sh.flags&Xtrace > 0 {
+		fmt.Fprintln(std.err, "+", strings.Join(append(assigns, args...), " "))
+	}
+	if b, ok := builtins[args[0]]; ok {
+		return b(sh, args[1:], std)
+	}
+	return sh.exec(args, assigns, std)
+}
+
+// fatal reports an expansion error, which terminates a non-interactive shell
+func (sh *interp) fatal(std stdio, err error) int {
+	fmt.Fprintf(std.err, "%s: %v\n", BuiltinShell, err)
+	sh.exited = true
+	return 1
+}
+
+// exec runs a binary through app with the exported variables as environment
+func (sh *interp) exec(args, assigns []string, std stdio) int {
+	a := &app{
+		bin:     args[0],
+		arg:     args[1:],
+		dir:     sh.dir,
+		cmd:     strings.Join(args, " "),
+		env:     assigns,
+		environ: sh.environ(assigns),
+		stdin:   std.in,
+		stdout:  std.out,
+		stderr:  std.err,
+	}
+	cmd, err := a.getCmd()
+	if err != nil {
+		a.finish(nil, err)
+		fmt.Fprintf(std.err, "%s: %v\n", BuiltinShell, err)
+		return 127
+	}
+	if err = a.launch(cmd, false); err == nil {
+		err = waitCmd(cmd.Wait)
+	}
+	if cerr := a.close(); cerr != nil {
+		err = cerr
+	}
+	a.finish(cmd, err)
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok && e.ExitCode() > 0 {
+			return e.ExitCode()
+		}
+		fmt.Fprintf(std.err, "%s: %v\n", BuiltinShell, err)
+		return 1
+	}
+	return 0
+}
+
+// environ returns the exported variables overridden by the command prefix assignments
+func (sh *interp) environ(assigns []string) (env []string) {
+	vars := make(map[string]string)
+	for k := range sh.exported {
+		if v, ok := sh.vars[k]; ok {
+			vars[k] = v
+		}
+	}
+	for _, kv := range assigns {
+		i := strings.IndexByte(kv, '=')
+		vars[kv[:i]] = kv[i+1:]
+	}
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return
+}
+
+// set assigns a `key=value` pair, optionally marking it exported
+func (sh *interp) set(kv string, export bool) {
+	i := strings.IndexByte(kv, '=')
+	sh.vars[kv[:i]] = kv[i+1:]
+	if export {
+		sh.exported[kv[:i]] = true
+	}
+}
+
+// path resolves the path against the interpreter working directory
+func (sh *interp) path(p string) string {
+	if p == "/dev/null" {
+		return os.DevNull
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(sh.dir, p)
+}
+
+// redirect applies the redirections to std, returning the files to be closed afterwards
+func (sh *interp) redirect(redirs []redirect, std stdio) (stdio, []io.Closer, error) {
+	var files []io.Closer
+	for _, r := range redirs {
+		target, err := sh.expandWord(r.target)
+		if err != nil {
+			return std, files, err
+		}
+		op, fd := r.op, -1
+		if op[0] >= '0' && op[0] <= '9' {
+			fd, op = int(op[0]-'0'), op[1:]
+		}
+		if fd < 0 {
+			fd = 1
+			if op[0] == '<' {
+				fd = 0
+			}
+		}
+		var in io.Reader
+		var out io.Writer
+		switch op {
+		case ">&", "<&":
+			switch {
+			case fd == 0 && target == "0":
+				in = std.in
+			case fd > 0 && target == "1":
+				out = std.out
+			case fd > 0 && target == "2":
+				out = std.err
+			default:
+				return std, files, fmt.Errorf("%s: bad file descriptor", target)
+			}
+		case "<":
+			f, err := os.Open(sh.path(target))
+			if err != nil {
+				return std, files, err
+			}
+			files, in = append(files, f), f
+		case ">", "&>":
+			f, err := os.Create(sh.path(target))
+			if err != nil {
+				return std, files, err
+			}
+			files, out = append(files, f), f
+		case ">>":
+			f, err := os.OpenFile(sh.path(target), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+			if err != nil {
+				return std, files, err
+			}
+			files, out = append(files, f), f
+		}
+		switch {
+		case op == "&>":
+			std.out, std.err = out, out
+		case fd == 0 && in != nil:
+			std.in = in
+		case fd == 1 && out != nil:
+			std.out = out
+		case fd == 2 && out != nil:
+			std.err = out
+		default:
+			return std, files, fmt.Errorf("%d%s: unsupported redirection", fd, op)
+		}
+	}
+	return std, files, nil
+}
+
+// Lookup returns the value of a variable or special parameter
+func (sh *interp) Lookup(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.status), true
+	case "#":
+		return strconv.Itoa(len(sh.args) - 1), true
+	case "@", "*":
+		return strings.Join(sh.args[1:], " "), true
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < len(sh.args) {
+			return sh.args[n], true
+		}
+		return "", false
+	}
+	v, ok := sh.vars[name]
+	return v, ok
+}
+
+// put assigns a shell variable, used by ${VAR:=default}
+func (sh *interp) put(key, val string) {
+	sh.vars[key] = val
+}
+
+// expandText substitutes parameters in s
+func (sh *interp) expandText(s string) (string, error) {
+	return expander{env: sh, nounset: sh.flags&Nounset > 0}.expand(s)
+}
+
+// expandWord expands a word into a single string, without field splitting or globbing
+func (sh *interp) expandWord(w word) (string, error) {
+	var b strings.Builder
+	for _, p := range w {
+		if p.literal {
+			b.WriteString(p.text)
+			continue
+		}
+		s, err := sh.expandText(p.text)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// fields expands words into command arguments with field splitting and pathname expansion
+func (sh *interp) fields(words []word) (fields []string, err error) {
+	for _, w := range words {
+		var cur strings.Builder
+		has, glob := false, false
+		flush := func() {
+			if has {
+				f := cur.String()
+				if matches := sh.glob(f, glob); matches != nil {
+					fields = append(fields, matches...)
+				} else {
+					fields = append(fields, f)
+				}
+			}
+			cur.Reset()
+			has, glob = false, false
+		}
+		for _, p := range w {
+			s := p.text
+			if !p.literal {
+				if s, err = sh.expandText(s); err != nil {
+					return nil, err
+				}
+			}
+			if p.quoted {
+				cur.WriteString(s)
+				has = true
+				continue
+			}
+			if strings.ContainsAny(p.text, "*?[") {
+				glob = true
+			}
+			if !strings.ContainsAny(s, " \t\n") {
+				cur.WriteString(s)
+				has = has || s != ""
+				continue
+			}
+			if strings.IndexAny(s, " \t\n") == 0 {
+				flush()
+			}
+			for i, f := range strings.Fields(s) {
+				if i > 0 {
+					flush()
+				}
+				cur.WriteString(f)
+				has = true
+			}
+			if strings.LastIndexAny(s, " \t\n") == len(s)-1 {
+				flush()
+			}
+		}
+		flush()
+	}
+	return
+}
+
+// glob returns the files matching pattern relative to the working directory, or nil if none
+func (sh *interp) glob(pattern string, glob bool) []string {
+	if !glob {
+		return nil
+	}
+	matches, err := filepath.Glob(sh.path(pattern))
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(pattern) {
+		for i, m := range matches {
+			if rel, err := filepath.Rel(sh.dir, m); err == nil {
+				matches[i] = rel
+			}
+		}
+	}
+	return matches
+}
+
+// builtins are the commands run by the interpreter itself
+var builtins = map[string]func(sh *interp, args []string, std stdio) int{
+	":":     func(*interp, []string, stdio) int { return 0 },
+	"true":  func(*interp, []string, stdio) int { return 0 },
+	"false": func(*interp, []string, stdio) int { return 1 },
+	"echo": func(sh *interp, args []string, std stdio) int {
+		newline := true
+		if len(args) > 0 && args[0] == "-n" {
+			newline, args = false, args[1:]
+		}
+		s := strings.Join(args, " ")
+		if newline {
+			s += "\n"
+		}
+		io.WriteString(std.out, s)
+		return 0
+	},
+	"pwd": func(sh *interp, args []string, std stdio) int {
+		fmt.Fprintln(std.out, sh.dir)
+		return 0
+	},
+	"cd": func(sh *interp, args []string, std stdio) int {
+		dir := sh.vars["HOME"]
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		dir = sh.path(dir)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			fmt.Fprintf(std.err, "%s: cd: %s: no such directory\n", BuiltinShell, dir)
+			return 1
+		}
+		sh.dir = filepath.Clean(dir)
+		sh.vars["PWD"] = sh.dir
+		return 0
+	},
+	"export": func(sh *interp, args []string, std stdio) int {
+		if len(args) == 0 {
+			for _, kv := range sh.environ(nil) {
+				i := strings.IndexByte(kv, '=')
+				fmt.Fprintf(std.out, "export %s=%s\n", kv[:i], strconv.Quote(kv[i+1:]))
+			}
+			return 0
+		}
+		for _, a := range args {
+			if i := strings.IndexByte(a, '='); i > 0 {
+				sh.set(a, true)
+			} else {
+				sh.exported[a] = true
+			}
+		}
+		return 0
+	},
+	"unset": func(sh *interp, args []string, std stdio) int {
+		for _, a := range args {
+			delete(sh.vars, a)
+			delete(sh.exported, a)
+		}
+		return 0
+	},
+	"shift": func(sh *interp, args []string, std stdio) int {
+		n := 1
+		if len(args) > 0 {
+			n, _ = strconv.Atoi(args[0])
+		}
+		if n < 0 || n >= len(sh.args) {
+			return 1
+		}
+		sh.args = append(sh.args[:1], sh.args[1+n:]...)
+		return 0
+	},
+	"set": func(sh *interp, args []string, std stdio) int {
+		for i := 0; i < len(args); i++ {
+			a := args[i]
+			if a == "--" {
+				sh.args = append(sh.args[:1], args[i+1:]...)
+				return 0
+			}
+			if len(a) < 2 || a[0] != '-' && a[0] != '+' {
+				fmt.Fprintf(std.err, "%s: set: %s: invalid option\n", BuiltinShell, a)
+				return 2
+			}
+			var flag ShellFlag
+			if a[1:] == "o" {
+				if i++; i >= len(args) || args[i] != "pipefail" {
+					fmt.Fprintf(std.err, "%s: set: unsupported option\n", BuiltinShell)
+					return 2
+				}
+				flag = Pipefail
+			} else {
+				for _, c := range a[1:] {
+					switch c {
+					case 'e':
+						flag |= Errexit
+					case 'u':
+						flag |= Nounset
+					case 'x':
+						flag |= Xtrace
+					default:
+						fmt.Fprintf(std.err, "%s: set: -%c: invalid option\n", BuiltinShell, c)
+						return 2
+					}
+				}
+			}
+			if a[0] == '-' {
+				sh.flags |= flag
+			} else {
+				sh.flags &^= flag
+			}
+		}
+		return 0
+	},
+	"exit": func(sh *interp, args []string, std stdio) int {
+		status := sh.status
+		if len(args) > 0 {
+			status, _ = strconv.Atoi(args[0])
+		}
+		sh.exited = true
+		return status
+	},
+}
+
+// interpret runs script with the builtin shell in the current working directory
+func interpret(conf ShellConfig, script string) error {
+	sh, err := newInterp(conf, workingDir)
+	if err != nil {
+		return err
+	}
+	return sh.capture(sh.run(script))
+}
+
+// interpretFile runs the script file with the builtin shell and the positional arguments
+func interpretFile(conf ShellConfig, path string, args []string) error {
+	sh, err := newInterp(conf, workingDir)
+	if err != nil {
+		return err
+	}
+	src, err := ioutil.ReadFile(sh.path(path))
+	if err != nil {
+		return err
+	}
+	sh.args = append(append([]string{path}, conf.Args...), args...)
+	return sh.capture(sh.run(string(src)))
+}
+
+// capture records the exported variables when the chain captures the env and the script succeeded
+func (sh *interp) capture(err error) error {
+	if err == nil && capturedEnv != nil {
+		recordEnv(sh.environ(nil))
+	}
+	return err
+}
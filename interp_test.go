@@ -0,0 +1,142 @@
+package run
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestParseScript(t *testing.T) {
+	list, err := parseScript("FOO=bar echo \"$FOO baz\" 'a b' > out 2>&1 && false || true | cat\necho")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, []string{"&&", "||"}, list[0].ops)
+
+	cmd := list[0].pipes[0].cmds[0]
+	assert.Equal(t, 1, len(cmd.assigns))
+	assert.Equal(t, 3, len(cmd.args))
+	assert.Equal(t, []redirect{{">", word{{"out", false, false}}}, {"2>&", word{{"1", false, false}}}}, cmd.redirs)
+	assert.Equal(t, 2, len(list[0].pipes[2].cmds))
+
+	_, err = parseScript(`echo "foo`)
+	assert.Error(t, err, "Unterminated quote should fail.")
+	_, err = parseScript(`echo foo &`)
+	assert.Error(t, err, "Background jobs are not supported.")
+	_, err = parseScript(`echo foo &&`)
+	assert.Error(t, err)
+}
+
+func TestBuiltinShell(t *testing.T) {
+	var output bytes.Buffer
+	Shell(BuiltinShell, `
+		FOO="foo  bar"
+		echo -n $FOO "$FOO" '$FOO' \$FOO
+	`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "foo bar foo  bar $FOO $FOO", output.String(), "Variable expansion failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `false && echo -n no || echo -n yes; ! false && echo -n " again"`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "yes again", output.String(), "And-or lists failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `echo -n $# $1 $2`).Using(ShellConfig{Args: []string{"foo", "bar"}}).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "2 foo bar", output.String(), "Positional parameters failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `shift | set -- x y z | true; echo -n $# $1 $2`).Using(ShellConfig{Args: []string{"foo", "bar"}}).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "2 foo bar", output.String(), "Pipeline stages should not change the positional parameters.")
+
+	output.Reset()
+	Shell(BuiltinShell, `FILE=main.go; echo -n ${UNSET:-${FILE%.go}} ${#FILE} ${X:=x}$X`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "main 7 xx", output.String(), "Parameter expansion failed.")
+
+	var exited bytes.Buffer
+	Shell(BuiltinShell, `exit 3; echo -n unreachable`).Pipe(Stdout, &exited).Run()
+	assert.Equal(t, "", exited.String())
+	assert.Equal(t, exitStatus(3), Shell(BuiltinShell, `exit 3`).Run())
+}
+
+func TestBuiltinShellParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	begin := time.Now()
+	err := Parallel(
+		Shell(BuiltinShell, `sleep 0.3`),
+		Shell(BuiltinShell, `sleep 0.3`),
+	).Run()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(begin) < 500*time.Millisecond, "Builtin shell branches should run at the same time")
+}
+
+func TestBuiltinShellFlags(t *testing.T) {
+	var output bytes.Buffer
+	err := Shell(BuiltinShell, `false; echo -n foo`).Using(ShellConfig{Flags: Errexit}).Pipe(Stdout, &output).Run()
+	assert.Error(t, err)
+	assert.Equal(t, "", output.String(), "Errexit should have stopped the script.")
+
+	var ignored bytes.Buffer
+	err = Shell(BuiltinShell, `false || echo -n foo`).Using(ShellConfig{Flags: Errexit}).Pipe(Stdout, &ignored).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", ignored.String(), "Errexit should ignore the left side of ||.")
+
+	err = Shell(BuiltinShell, `echo $UNSET_RUN_VAR`).Using(ShellConfig{Flags: Nounset}).Run()
+	assert.Error(t, err, "Nounset should have failed on unset variable.")
+
+	err = Shell(BuiltinShell, `set -e; false; true`).Run()
+	assert.Error(t, err, "set -e should enable errexit.")
+}
+
+func TestBuiltinShellCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	Shell(BuiltinShell, `cat test/foo | cat | cat`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "text from foo\n", output.String(), "Pipes failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `cd test; cat foo bar`).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "text from foo\nthis is content of bar\n", output.String(), "cd failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `cat foo.*`).At("test").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "@echo FOOBAR#!/bin/bash\necho -n FOOBAR\n", output.String(), "Globbing failed.")
+
+	output.Reset()
+	Shell(BuiltinShell, `export TEST_RUN_VAR=foo; BAR=bar sh -c 'echo -n $TEST_RUN_VAR $BAR $t'`).With("t=test").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "foo bar test", output.String(), "Environment not passed to binaries.")
+
+	assert.Equal(t, exitStatus(127), Shell(BuiltinShell, `doesnotexist 2>/dev/null`).Run())
+	assert.Equal(t, exitStatus(1), Shell(BuiltinShell, `false | true`).Using(ShellConfig{Flags: Pipefail}).Run())
+}
+
+func TestBuiltinShellRedirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var output bytes.Buffer
+	Shell(BuiltinShell, `
+		echo foo > out
+		echo bar >> out
+		echo baz 1>&2 2>/dev/null
+		echo qux 2>err >&2
+	`).At(dir).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "", output.String())
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "out"))
+	assert.Equal(t, "foo\nbar\n", string(out))
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "err"))
+	assert.Equal(t, "qux\n", string(out))
+
+	output.Reset()
+	Script("foo.sh").Using(ShellConfig{Bin: BuiltinShell}).At("test").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "FOOBAR", output.String(), "Script file failed.")
+}
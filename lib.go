@@ -1,12 +1,9 @@
 package run
 
 import (
-	"fmt"
 	"strings"
 	"unicode"
 	"strconv"
-
-	"github.com/howeyc/gopass"
 )
 
 
@@ -72,24 +69,20 @@ func parseCommand(command string) (exe string, arg, env []string) {
 }
 
 
-// Prompt prompts user for input with plain value.
+// Prompt prompts user for a line of input, see Prompter for more options.
 func Prompt(prompt string) string {
-    fmt.Print(prompt)
-    var input string
-    fmt.Scanln(&input)
-    fmt.Println(input)
-    return input
+	input, _ := (&Prompter{}).Ask(Question{Prompt: prompt})
+	return input
 }
 
-// PromptHidden prompts user for hidden terminal input.
+// PromptHidden prompts user for hidden terminal input, or reads a line of piped input.
 func PromptHidden(prompt string) string {
-	fmt.Print(prompt)
-	return string(gopass.GetPasswd())
+	input, _ := (&Prompter{}).Hidden(Question{Prompt: prompt})
+	return input
 }
 
-
-// PromptMasked prompts user for masked terminal input.
+// PromptMasked prompts user for masked terminal input, or reads a line of piped input.
 func PromptMasked(prompt string) string {
-	fmt.Print(prompt)
-	return string(gopass.GetPasswdMasked())
-}
\ No newline at end of file
+	input, _ := (&Prompter{}).Masked(Question{Prompt: prompt})
+	return input
+}
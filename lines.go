@@ -0,0 +1,147 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LineOutput configures the line mode set by Lines
+type LineOutput struct {
+	// Prefix is written before each line, "{name} | " if empty. It may contain the placeholders
+	// {name}, {pid}, {time} and {stream}, which is "out" or "err".
+	Prefix string
+	// Name replaces {name}, by default the name of the task run by Do, or the binary name
+	Name string
+	// TimeFormat formats {time}, "15:04:05.000" if empty
+	TimeFormat string
+	// Color writes the prefix in an ANSI color, a different one for each process
+	Color bool
+	// Func receives the lines instead of writing them, with the stream Stdout or Stderr
+	Func func(line string, stream int)
+}
+
+// lineOutput is the line mode of the running chain, nil if not enabled
+var lineOutput *LineOutput
+
+// taskName is the name of the task run by Do
+var taskName string
+
+// lineColors are cycled through by the processes of colored line output
+var lineColors = []string{"36", "33", "32", "35", "34", "31", "96", "93", "92", "95", "94", "91"}
+
+var nextColor uint32
+
+// lineLock keeps lines of different processes from mixing
+var lineLock sync.Mutex
+
+// writers returns the stdout and stderr writers of the app
+func (o *LineOutput) writers(a *app, stdout, stderr io.Writer) (io.WriteCloser, io.WriteCloser) {
+	l := &lineFormat{LineOutput: *o, app: a}
+	if l.Prefix == "" {
+		l.Prefix = "{name} | "
+	}
+	if l.TimeFormat == "" {
+		l.TimeFormat = "15:04:05.000"
+	}
+	if l.Name == "" {
+		l.Name = taskName
+	}
+	if l.Name == "" {
+		l.Name = filepath.Base(a.bin)
+	}
+	if l.Color {
+		l.color = lineColors[int(atomic.AddUint32(&nextColor, 1)-1)%len(lineColors)]
+	}
+	return &prefixWriter{format: l, w: stdout, stream: Stdout}, &prefixWriter{format: l, w: stderr, stream: Stderr}
+}
+
+// lineFormat is the line mode of a single process
+type lineFormat struct {
+	LineOutput
+	app   *app
+	color string
+}
+
+func (l *lineFormat) prefix(stream int) string {
+	r := strings.NewReplacer(
+		"{name}", l.Name,
+		"{pid}", strconv.Itoa(l.app.startedProc().Pid),
+		"{time}", time.Now().Format(l.TimeFormat),
+		"{stream}", map[int]string{Stdout: "out", Stderr: "err"}[stream],
+	)
+	p := r.Replace(l.Prefix)
+	if l.color != "" {
+		p = "\x1b[" + l.color + "m" + p + "\x1b[0m"
+	}
+	return p
+}
+
+// prefixWriter writes complete lines with the prefix of the process, or passes them to Func
+type prefixWriter struct {
+	sync.Mutex
+	format *lineFormat
+	w      io.Writer
+	stream int
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := p.line(string(p.buf[:i])); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Close writes the pending incomplete line
+func (p *prefixWriter) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.line(string(p.buf))
+	p.buf = nil
+	return err
+}
+
+func (p *prefixWriter) line(s string) error {
+	s = strings.TrimSuffix(s, "\r")
+	if p.format.Func != nil {
+		p.format.Func(s, p.stream)
+		return nil
+	}
+	lineLock.Lock()
+	defer lineLock.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s\n", p.format.prefix(p.stream), s)
+	return err
+}
+
+func lines(o LineOutput, run Runnable) Runnable {
+	return runner(func() error {
+		old := lineOutput
+		defer func() {
+			lineOutput = old
+		}()
+		lineOutput = &o
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestLines(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	err := Shell(`echo one; printf 'two\nthree'`).Lines(LineOutput{Name: "web"}).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "web | one\nweb | two\nweb | three\n", output.String(), "Each line should be prefixed")
+
+	output.Reset()
+	err = Shell(`echo $TOKEN`).WithSecret("TOKEN=s3cr3t").Scrub().Lines(LineOutput{Prefix: "[{name}:{stream}:{pid}] "}).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	line := output.String()
+	assert.True(t, strings.HasPrefix(line, "[sh:out:"), line)
+	assert.True(t, strings.HasSuffix(line, "] ***\n"), "Secrets should be scrubbed from the lines")
+	assert.False(t, strings.HasPrefix(line, "[sh:out:0]"), "The pid should be known")
+
+	output.Reset()
+	err = Shell(`echo colored`).Lines(LineOutput{Name: "a", Color: true}).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output.String(), "\x1b["), output.String())
+	assert.True(t, strings.HasSuffix(output.String(), "a | \x1b[0mcolored\n"), output.String())
+}
+
+func TestLinesPid(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// the output is copied while the process starts, run with -race.
+	// Logging would synchronize the goroutines through its writes.
+	old := logger
+	defer func() {
+		logger = old
+	}()
+	SetLogger(nil)
+	for i := 0; i < 10; i++ {
+		var output bytes.Buffer
+		err := Shell(`echo $$; echo $$ >&2`).Lines(LineOutput{Prefix: "{pid} "}).Pipe(Stdout, &output).Run()
+		assert.NoError(t, err)
+		fields := strings.Fields(output.String())
+		assert.Equal(t, 2, len(fields), output.String())
+		assert.Equal(t, fields[1], fields[0], "The prefix should be the pid of the process")
+	}
+}
+
+func TestLinesFunc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var mu sync.Mutex
+	var lines []string
+	var output bytes.Buffer
+	err := Shell(`echo out; echo err >&2`).Lines(LineOutput{Func: func(line string, stream int) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, fmt.Sprint(stream, line))
+	}}).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "", output.String(), "Lines passed to Func should not be written")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, lines[0] == fmt.Sprint(Stdout, "out") || lines[1] == fmt.Sprint(Stdout, "out"), lines)
+	assert.True(t, lines[0] == fmt.Sprint(Stderr, "err") || lines[1] == fmt.Sprint(Stderr, "err"), lines)
+}
+
+func TestLinesTaskName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	defer func() {
+		taskMap = make(map[string]*task)
+	}()
+	var output bytes.Buffer
+	Task("build", nil, Shell(`echo built`))
+	err := runner(func() error {
+		return Do("build")
+	}).Lines(LineOutput{}).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "build | built\n", output.String(), "The task name should be the default name")
+}
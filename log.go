@@ -0,0 +1,94 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Events passed to Logger.Log, with their fields
+const (
+	// EventEnvResolved reports Env before a command is loaded: env (secrets redacted)
+	EventEnvResolved = "env resolved"
+	// EventCommandLoaded reports a command ready to start: cmd, path, dir
+	EventCommandLoaded = "command loaded"
+	// EventCommandStarted reports a started process: cmd, pid, async
+	EventCommandStarted = "command started"
+	// EventCommandExited reports a finished process: cmd, pid, code, duration, and error if it failed to run
+	EventCommandExited = "command exited"
+	// EventProcessKilled reports a process stopped by Stop: cmd, pid, started
+	EventProcessKilled = "process killed"
+	// EventDirChanged reports the working directory set by At, or by In with chdir true: dir, chdir
+	EventDirChanged = "directory changed"
+	// EventChainSkipped reports a chain skipped by Sources and Targets: sources, targets
+	EventChainSkipped = "chain skipped"
+	// EventTaskStarted reports a task started by Do: task
+	EventTaskStarted = "task started"
+	// EventTaskSkipped reports a task skipped by Do after a failed dependency: task, dependency
+	EventTaskSkipped = "task skipped"
+)
+
+// Logger receives the events of go-run with their fields as alternating keys and values,
+// like the methods of log/slog.Logger.
+type Logger interface {
+	Log(event string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to Logger, e.g.
+//
+//	run.SetLogger(run.LoggerFunc(slog.Default().Info))
+type LoggerFunc func(event string, keyvals ...interface{})
+
+// Log implements Logger interface
+func (f LoggerFunc) Log(event string, keyvals ...interface{}) {
+	f(event, keyvals...)
+}
+
+// logger receives the events, discarded by default
+var logger Logger = NewTextLogger(ioutil.Discard)
+
+// SetLogger sets the Logger receiving the events, nil discards them
+func SetLogger(l Logger) {
+	if l == nil {
+		l = NewTextLogger(ioutil.Discard)
+	}
+	logger = l
+}
+
+// textLogger writes an event per line, followed by its fields as key=value pairs
+type textLogger struct {
+	*log.Logger
+}
+
+// NewTextLogger returns a Logger writing one line per event to w, like
+//
+//	[run] 2009/11/10 23:00:00 command exited cmd="go build" pid=42 code=0 duration=1.5s
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{log.New(w, "[run] ", log.LstdFlags)}
+}
+
+// Log implements Logger interface
+func (l *textLogger) Log(event string, keyvals ...interface{}) {
+	if l.Writer() == ioutil.Discard {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(event)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, val := fmt.Sprint(keyvals[i]), interface{}(nil)
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		} else {
+			key, val = "!BADKEY", keyvals[i]
+		}
+		s := fmt.Sprint(val)
+		if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(" " + key + "=" + s)
+	}
+	l.Print(b.String())
+}
@@ -0,0 +1,77 @@
+package run
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+type logEvent struct {
+	event  string
+	fields map[string]interface{}
+}
+
+// recordEvents sets a Logger recording the events until the returned func is called
+func recordEvents() (*[]logEvent, func()) {
+	old := logger
+	var events []logEvent
+	SetLogger(LoggerFunc(func(event string, keyvals ...interface{}) {
+		e := logEvent{event, make(map[string]interface{})}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			e.fields[keyvals[i].(string)] = keyvals[i+1]
+		}
+		events = append(events, e)
+	}))
+	return &events, func() {
+		SetLogger(old)
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	var output bytes.Buffer
+	l := NewTextLogger(&output)
+	l.Log(EventCommandExited, "cmd", "go build", "code", 0, "duration", 1500*time.Millisecond, "dir", "", "odd")
+	line := output.String()
+	assert.True(t, strings.HasPrefix(line, "[run] "), line)
+	assert.True(t, strings.HasSuffix(line, ` command exited cmd="go build" code=0 duration=1.5s dir="" !BADKEY=odd`+"\n"), line)
+}
+
+func TestLoggerEvents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	events, reset := recordEvents()
+	defer reset()
+
+	Shell(`exit 3`).At("test").WithSecret("TOKEN=s3cr3t").Run()
+
+	var names []string
+	for _, e := range *events {
+		names = append(names, e.event)
+	}
+	assert.Equal(t, []string{EventDirChanged, EventEnvResolved, EventCommandLoaded, EventCommandStarted, EventCommandExited}, names)
+	if len(*events) == 5 {
+		assert.Equal(t, "test", (*events)[0].fields["dir"])
+		assert.Equal(t, "TOKEN=***", (*events)[1].fields["env"])
+		assert.Equal(t, "exit 3", (*events)[2].fields["cmd"])
+		assert.Equal(t, false, (*events)[3].fields["async"])
+		pid := (*events)[3].fields["pid"]
+		assert.True(t, pid.(int) > 0)
+		assert.Equal(t, pid, (*events)[4].fields["pid"])
+		assert.Equal(t, 3, (*events)[4].fields["code"])
+		_, ok := (*events)[4].fields["duration"].(time.Duration)
+		assert.True(t, ok)
+	}
+
+	*events = nil
+	Call("doesnotexist").Run()
+	assert.Equal(t, 0, len(*events), "Commands not found should fail before loading")
+
+	SetLogger(nil)
+	Call("true").Run()
+	assert.Equal(t, 0, len(*events), "A nil Logger should discard the events")
+}
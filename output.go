@@ -0,0 +1,132 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// OutputLine is a line of output and the stream it was written to, Stdout or Stderr
+type OutputLine struct {
+	Stream int
+	Text   string
+}
+
+// Output records the stdout and stderr lines of the commands in a single list,
+// in the order they were received, each tagged with its stream.
+// Each stream keeps its order, but the streams are separate pipes, so lines written
+// to both at nearly the same time may be recorded in either order.
+type Output struct {
+	mu    sync.Mutex
+	lines []OutputLine
+	// partial holds the incomplete last line of each stream
+	partial map[int][]byte
+}
+
+// Lines returns the recorded lines in order
+func (o *Output) Lines() []OutputLine {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutputLine(nil), o.lines...)
+}
+
+// String returns the combined output, one line per recorded line
+func (o *Output) String() string {
+	return o.text(Stdout | Stderr)
+}
+
+// Stdout returns the lines of stdout
+func (o *Output) Stdout() string {
+	return o.text(Stdout)
+}
+
+// Stderr returns the lines of stderr
+func (o *Output) Stderr() string {
+	return o.text(Stderr)
+}
+
+func (o *Output) text(streams int) string {
+	var s strings.Builder
+	for _, l := range o.Lines() {
+		if l.Stream&streams > 0 {
+			s.WriteString(l.Text)
+			s.WriteByte('\n')
+		}
+	}
+	return s.String()
+}
+
+// Replay writes the recorded lines to the writers of their streams, in order
+func (o *Output) Replay(stdout, stderr io.Writer) error {
+	for _, l := range o.Lines() {
+		w := stdout
+		if l.Stream == Stderr {
+			w = stderr
+		}
+		if _, err := fmt.Fprintln(w, l.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset discards the recorded lines
+func (o *Output) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines, o.partial = nil, nil
+}
+
+// write records the complete lines of p
+func (o *Output) write(stream int, p []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.partial == nil {
+		o.partial = make(map[int][]byte)
+	}
+	buf := append(o.partial[stream], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		o.lines = append(o.lines, OutputLine{stream, strings.TrimSuffix(string(buf[:i]), "\r")})
+		buf = buf[i+1:]
+	}
+	o.partial[stream] = buf
+}
+
+// flush records the incomplete last lines
+func (o *Output) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, stream := range []int{Stdout, Stderr} {
+		if buf := o.partial[stream]; len(buf) > 0 {
+			o.lines = append(o.lines, OutputLine{stream, string(buf)})
+		}
+		delete(o.partial, stream)
+	}
+}
+
+// outputStream records the writes of a stream into an Output
+type outputStream struct {
+	out    *Output
+	stream int
+}
+
+func (s outputStream) Write(p []byte) (int, error) {
+	s.out.write(s.stream, p)
+	return len(p), nil
+}
+
+func captureOutput(out *Output, run Runnable) Runnable {
+	return runner(func() error {
+		defer out.flush()
+		return redirectOutput(Stdout|Stderr, func(stream int, _ *os.File) io.Writer {
+			return outputStream{out, stream}
+		}, run)
+	})
+}
@@ -0,0 +1,102 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+// streamLines returns the lines recorded for the stream, in order
+func streamLines(out *Output, stream int) (lines []string) {
+	for _, l := range out.Lines() {
+		if l.Stream == stream {
+			lines = append(lines, l.Text)
+		}
+	}
+	return
+}
+
+func TestCaptureOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var out Output
+	err := Shell(`echo one; echo two >&2; printf three`).CaptureOutput(&out).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(out.Lines()))
+	assert.Equal(t, []string{"one", "three"}, streamLines(&out, Stdout), "Lines should be recorded in order with their stream")
+	assert.Equal(t, []string{"two"}, streamLines(&out, Stderr), "Lines should be recorded in order with their stream")
+	assert.Equal(t, "one\nthree\n", out.Stdout())
+	assert.Equal(t, "two\n", out.Stderr())
+
+	var stdout, stderr bytes.Buffer
+	assert.NoError(t, out.Replay(&stdout, &stderr))
+	assert.Equal(t, "one\nthree\n", stdout.String())
+	assert.Equal(t, "two\n", stderr.String())
+
+	out.Reset()
+	err = Shell(`echo failed >&2; exit 2`).CaptureOutput(&out).Run()
+	assert.Error(t, err)
+	assert.Equal(t, []OutputLine{{Stderr, "failed"}}, out.Lines(), "Output should be recorded when the command fails")
+}
+
+func TestCaptureOutputInterleaved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var outs, errs []string
+	for i := 0; i < 200; i++ {
+		outs, errs = append(outs, fmt.Sprint("out", i)), append(errs, fmt.Sprint("err", i))
+	}
+	var out Output
+	err := Shell(`i=0; while [ $i -lt 200 ]; do echo out$i; echo err$i >&2; i=$((i+1)); done`).CaptureOutput(&out).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, 400, len(out.Lines()))
+	assert.Equal(t, outs, streamLines(&out, Stdout), "Tightly interleaved writes should keep the order of their stream")
+	assert.Equal(t, errs, streamLines(&out, Stderr), "Tightly interleaved writes should keep the order of their stream")
+
+	out.Reset()
+	err = runner(func() error {
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(os.Stdout, "out%d\n", i)
+			fmt.Fprintf(os.Stderr, "err%d\n", i)
+		}
+		return nil
+	}).CaptureOutput(&out).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, outs, streamLines(&out, Stdout), "Writes of the process should be recorded")
+	assert.Equal(t, errs, streamLines(&out, Stderr), "Writes of the process should be recorded")
+}
+
+func TestCaptureOutputLarge(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var out Output
+	err := Shell(`dd if=/dev/zero bs=300000 count=1 2>/dev/null | tr '\0' x > big; cat big; echo; echo done >&2; rm big`).CaptureOutput(&out).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 300000)+"\n", out.Stdout(), "Large writes should be recorded")
+	assert.Equal(t, "done\n", out.Stderr())
+
+	out.Reset()
+	err = runner(func() error {
+		_, err := os.Stdout.Write([]byte(strings.Repeat("y", 300<<10) + "\n"))
+		return err
+	}).CaptureOutput(&out).Run()
+	assert.NoError(t, err, "A single write above 256 KB should succeed")
+	assert.Equal(t, strings.Repeat("y", 300<<10)+"\n", out.Stdout())
+}
+
+func TestOutputWrite(t *testing.T) {
+	var out Output
+	outputStream{&out, Stdout}.Write([]byte("par"))
+	outputStream{&out, Stderr}.Write([]byte("err\r\n"))
+	outputStream{&out, Stdout}.Write([]byte("tial\nrest"))
+	out.flush()
+	assert.Equal(t, []OutputLine{{Stderr, "err"}, {Stdout, "partial"}, {Stdout, "rest"}}, out.Lines(), "Lines should be recorded once complete")
+}
@@ -0,0 +1,190 @@
+package run
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// chainState is the package state set up by the wrappers of a chain for its commands
+type chainState struct {
+	dir      string
+	wd       string
+	env      *EnvSet
+	shell    ShellConfig
+	filter   envFilter
+	scrub    bool
+	captured *[]envChange
+	hooks    []Hooks
+	lines    *LineOutput
+	task     string
+	tty      bool
+	expect   []expectStep
+	stdin    *os.File
+	stdout   *os.File
+	stderr   *os.File
+}
+
+func saveState() chainState {
+	wd, _ := os.Getwd()
+	return chainState{
+		dir:      workingDir,
+		wd:       wd,
+		env:      Env,
+		shell:    shellConfig,
+		filter:   processEnv.filter,
+		scrub:    scrubOutput,
+		captured: capturedEnv,
+		hooks:    chainHooks,
+		lines:    lineOutput,
+		task:     taskName,
+		tty:      ttyMode,
+		expect:   expectSteps,
+		stdin:    os.Stdin,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+	}
+}
+
+// restore sets the package state back. An unchanged state is not written again,
+// so chains running on other goroutines next to Parallel only see writes of chains changing it.
+func (s chainState) restore() {
+	if s.same(saveState()) {
+		return
+	}
+	if wd, _ := os.Getwd(); wd != s.wd && s.wd != "" {
+		os.Chdir(s.wd)
+	}
+	workingDir = s.dir
+	Env = s.env
+	shellConfig = s.shell
+	processEnv.filter = s.filter
+	scrubOutput = s.scrub
+	capturedEnv = s.captured
+	chainHooks = s.hooks
+	lineOutput = s.lines
+	taskName = s.task
+	ttyMode = s.tty
+	expectSteps = s.expect
+	os.Stdin, os.Stdout, os.Stderr = s.stdin, s.stdout, s.stderr
+}
+
+// same reports whether both states hold the same values, slices being compared by identity
+func (s chainState) same(o chainState) bool {
+	return s.dir == o.dir && s.wd == o.wd && s.env == o.env &&
+		s.shell.Bin == o.shell.Bin && s.shell.Flags == o.shell.Flags && sameSlice(s.shell.Args, o.shell.Args) &&
+		s.filter.isolated == o.filter.isolated && sameSlice(s.filter.allow, o.filter.allow) && sameSlice(s.filter.deny, o.filter.deny) &&
+		s.scrub == o.scrub && s.captured == o.captured && sameSlice(s.hooks, o.hooks) && s.lines == o.lines &&
+		s.task == o.task && s.tty == o.tty && sameSlice(s.expect, o.expect) &&
+		s.stdin == o.stdin && s.stdout == o.stdout && s.stderr == o.stderr
+}
+
+func sameSlice(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Len() == vb.Len() && (va.Len() == 0 || va.Pointer() == vb.Pointer())
+}
+
+// Chains share the package state, so the branches of Parallel take turns:
+// a branch holds chainLock while it sets up and starts its commands,
+// and hands it over while waiting for a child process to exit.
+var (
+	chainLock sync.Mutex
+	// chainOwner is the goroutine holding chainLock, 0 if none.
+	// Only the holder hands the lock over, chains run on other goroutines just wait for their commands.
+	chainOwner int64
+)
+
+func lockChain() {
+	chainLock.Lock()
+	atomic.StoreInt64(&chainOwner, goid())
+}
+
+func unlockChain() {
+	atomic.StoreInt64(&chainOwner, 0)
+	chainLock.Unlock()
+}
+
+// ownsChain reports whether the caller is a branch of Parallel holding chainLock
+func ownsChain() bool {
+	return atomic.LoadInt64(&chainOwner) == goid()
+}
+
+// goid returns the id of the calling goroutine, read from the header of its stack trace
+func goid() int64 {
+	b := make([]byte, 64)
+	b = bytes.TrimPrefix(b[:runtime.Stack(b, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// waitCmd waits for a started command, letting other branches run meanwhile
+// if the caller is a branch of Parallel.
+func waitCmd(wait func() error) error {
+	if !ownsChain() {
+		return wait()
+	}
+	s := saveState()
+	unlockChain()
+	defer func() {
+		lockChain()
+		s.restore()
+	}()
+	return wait()
+}
+
+// Parallel defines a Runnable object, which runs the runnables at the same time
+// and returns the error of the first failing one in order once all finished
+func Parallel(runs ...Runnable) Runnable {
+	return parallel(runs, nil)
+}
+
+func parallel(runs []Runnable, run Runnable) Runnable {
+	return runner(func() error {
+		if run != nil {
+			if err := run.Run(); err != nil {
+				return err
+			}
+		}
+		base := saveState()
+		// a top level Parallel takes the lock, a nested one runs in a branch holding it
+		top := !ownsChain()
+		if top {
+			lockChain()
+		}
+
+		errs := make([]error, len(runs))
+		var wg sync.WaitGroup
+		for i, r := range runs {
+			wg.Add(1)
+			go func(i int, r Runnable) {
+				defer wg.Done()
+				lockChain()
+				defer unlockChain()
+				base.restore()
+				errs[i] = r.Run()
+			}(i, r)
+		}
+		waitCmd(func() error {
+			wg.Wait()
+			return nil
+		})
+
+		base.restore()
+		if top {
+			unlockChain()
+		}
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package run
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "a"), 0755)
+	os.Mkdir(filepath.Join(dir, "b"), 0755)
+
+	begin := time.Now()
+	err = Parallel(
+		Shell(`sleep 0.3; echo -n $X > out`).At(filepath.Join(dir, "a")).With("X=a"),
+		Shell(`sleep 0.1`).Shell(`sleep 0.2; echo -n $X > out`).At(filepath.Join(dir, "b")).With("X=b"),
+	).Run()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(begin) < 500*time.Millisecond, "Branches should run at the same time")
+
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "a", "out"))
+	assert.Equal(t, "a", string(out), "Branches should keep their own chain state")
+	out, _ = ioutil.ReadFile(filepath.Join(dir, "b", "out"))
+	assert.Equal(t, "b", string(out), "Branches should keep their own chain state")
+	assert.Equal(t, "", workingDir)
+	assert.Equal(t, "", Env.Get("X"))
+}
+
+func TestParallelChain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	err := Shell(`echo -n 1`).Parallel(
+		Shell(`sleep 0.1; echo -n 3`),
+		Shell(`echo -n 2`),
+	).Shell(`echo -n 4`).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", output.String())
+
+	err = Parallel(Shell(`exit 0`), Shell(`exit 2`), Parallel(Shell(`exit 3`))).Run()
+	assert.Error(t, err)
+	assert.Equal(t, "exit status 2", err.Error(), "The first failing branch should be reported")
+}
+
+func TestParallelConcurrentChains(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	begin := time.Now()
+	errs := make(chan error, 3)
+	go func() {
+		errs <- Call("sleep 0.2").Run()
+	}()
+	go func() {
+		errs <- Parallel(Call("sleep 0.2"), Call("sleep 0.2")).Run()
+	}()
+	go func() {
+		errs <- Parallel(Call("sleep 0.2"), Parallel(Call("sleep 0.2"))).Run()
+	}()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.True(t, time.Since(begin) < 500*time.Millisecond, "Chains on other goroutines should not wait for each other")
+	assert.Equal(t, int64(0), chainOwner, "The lock should be released")
+}
@@ -0,0 +1,86 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// PathListKeys are the variables whose values translate the PathListSeparator template
+// when set through Set or loaded from dotenv files. Other values keep "::" as is,
+// append a key to opt it in.
+var PathListKeys = []string{"PATH", "GOPATH"}
+
+// isPathList reports whether key opted in to the PathListSeparator translation
+func isPathList(key string) bool {
+	for _, k := range PathListKeys {
+		if k == key || runtime.GOOS == "windows" && strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// translatePathList replaces the PathListSeparator template in the value of path list keys
+func translatePathList(key, val string) string {
+	if !isPathList(key) || !strings.Contains(val, PathListSeparator) {
+		return val
+	}
+	return strings.Replace(val, PathListSeparator, string(os.PathListSeparator), -1)
+}
+
+// PathList returns the non-empty entries of the path list stored in key
+func (e *EnvSet) PathList(key string) (dirs []string) {
+	for _, dir := range filepath.SplitList(e.Get(key)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return
+}
+
+// PrependPath puts dirs in front of the path list stored in key.
+// Entries already in the list are moved, so every directory appears once.
+func (e *EnvSet) PrependPath(key string, dirs ...string) {
+	e.setPathList(key, append(append([]string(nil), dirs...), e.PathList(key)...))
+}
+
+// AppendPath adds dirs at the end of the path list stored in key.
+// Entries already in the list keep their position and precedence.
+func (e *EnvSet) AppendPath(key string, dirs ...string) {
+	e.setPathList(key, append(e.PathList(key), dirs...))
+}
+
+// RemovePath drops all occurrences of dirs from the path list stored in key
+func (e *EnvSet) RemovePath(key string, dirs ...string) {
+	var keep []string
+	for _, dir := range e.PathList(key) {
+		if !containsPath(dirs, dir) {
+			keep = append(keep, dir)
+		}
+	}
+	e.setPathList(key, keep)
+}
+
+// setPathList stores the deduplicated list joined with os.PathListSeparator
+func (e *EnvSet) setPathList(key string, dirs []string) {
+	var list []string
+	for _, dir := range dirs {
+		if dir != "" && !containsPath(list, dir) {
+			list = append(list, dir)
+		}
+	}
+	e.put(key, strings.Join(list, string(os.PathListSeparator)))
+}
+
+// containsPath reports whether dirs holds a path equal to dir once cleaned
+func containsPath(dirs []string, dir string) bool {
+	dir = filepath.Clean(dir)
+	for _, d := range dirs {
+		if filepath.Clean(d) == dir || runtime.GOOS == "windows" && strings.EqualFold(filepath.Clean(d), dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package run
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestPathListTranslation(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	env, err := NewEnv("PATH=foo::bar", "ADDR=fe80::1", "NAME=std::string")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo"+sep+"bar", env.Get("PATH"), "PATH should have replaced run.PathListSeparator")
+	assert.Equal(t, "fe80::1", env.Get("ADDR"), "Other keys should keep \"::\"")
+	assert.Equal(t, []string{"PATH=foo" + sep + "bar", "ADDR=fe80::1", "NAME=std::string"}, env.List())
+
+	keys := PathListKeys
+	defer func() {
+		PathListKeys = keys
+	}()
+	PathListKeys = append(PathListKeys, "PYTHONPATH")
+	env.Set("PYTHONPATH=lib::vendor")
+	assert.Equal(t, "lib"+sep+"vendor", env.Get("PYTHONPATH"), "Opted in keys should translate")
+
+	assert.NoError(t, env.parseDotenv("PATH=a::b\nQUOTED=\"a::b\"\n"))
+	assert.Equal(t, "a"+sep+"b", env.Get("PATH"))
+	assert.Equal(t, "a::b", env.Get("QUOTED"))
+}
+
+func TestPathListEdit(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	env, _ := NewEnv()
+	env.put("PATH", strings.Join([]string{"/usr/bin", "", "/bin", "/usr/bin/"}, sep))
+	assert.Equal(t, []string{"/usr/bin", "/bin", "/usr/bin/"}, env.PathList("PATH"))
+
+	env.PrependPath("PATH", "./bin", "/bin")
+	assert.Equal(t, []string{"./bin", "/bin", "/usr/bin"}, env.PathList("PATH"), "Prepended entries should move to the front once")
+
+	env.AppendPath("PATH", "/opt/bin", "bin")
+	assert.Equal(t, []string{"./bin", "/bin", "/usr/bin", "/opt/bin"}, env.PathList("PATH"), "Appended duplicates should keep their position")
+
+	env.RemovePath("PATH", "/bin", "bin/")
+	assert.Equal(t, strings.Join([]string{"/usr/bin", "/opt/bin"}, sep), env.Get("PATH"))
+
+	env.RemovePath("PATH", "/usr/bin", "/opt/bin")
+	v, ok := env.Lookup("PATH")
+	assert.True(t, ok)
+	assert.Equal(t, "", v)
+
+	child := env.Layer(WithLayer)
+	child.AppendPath("GOPATH", "/go")
+	assert.Equal(t, "/go", child.Get("GOPATH"))
+	assert.Equal(t, "", env.Get("GOPATH"), "Edits should stay in the scope of the set")
+}
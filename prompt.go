@@ -0,0 +1,292 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNoAnswer is returned when a question gets no answer and has no default
+var ErrNoAnswer = errors.New("no answer")
+
+// Question is asked by a Prompter
+type Question struct {
+	// Name identifies the question in the Answers of non-interactive runs
+	Name string
+	// Prompt is shown to the user
+	Prompt string
+	// Default is the answer to an empty input
+	Default string
+	// Validate rejects invalid answers with an error shown before asking again
+	Validate func(answer string) error
+}
+
+// Answers returns the prepared answer to the question name
+type Answers func(name string) (string, bool)
+
+// EnvAnswers returns the answers from the variables of Env named prefix followed by the
+// question name in upper case, other characters than letters and digits replaced by "_".
+// The answer to "deploy target" with the prefix "ANSWER_" is ANSWER_DEPLOY_TARGET.
+func EnvAnswers(prefix string) Answers {
+	return func(name string) (string, bool) {
+		return Env.Lookup(prefix + answerKey(name))
+	}
+}
+
+// FileAnswers returns the answers from a dotenv file, named like EnvAnswers without prefix
+func FileAnswers(path string) (Answers, error) {
+	env, _ := NewEnv()
+	if err := env.Load(path); err != nil {
+		return nil, err
+	}
+	return func(name string) (string, bool) {
+		return env.Lookup(answerKey(name))
+	}, nil
+}
+
+func answerKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
+
+// Prompter asks questions on the terminal or answers them from prepared answers
+type Prompter struct {
+	// In is read for the answers, os.Stdin if nil
+	In io.Reader
+	// Out shows the prompts, os.Stdout if nil
+	Out io.Writer
+	// Answers are taken before asking, when they have one for the question
+	Answers Answers
+	// NonInteractive never reads In: questions without prepared answers take their
+	// default or fail with ErrNoAnswer
+	NonInteractive bool
+}
+
+func (p *Prompter) in() io.Reader {
+	if p.In == nil {
+		return os.Stdin
+	}
+	return p.In
+}
+
+func (p *Prompter) out() io.Writer {
+	if p.Out == nil {
+		return os.Stdout
+	}
+	return p.Out
+}
+
+func (p *Prompter) readLine() (string, error) {
+	return readLine(p.in())
+}
+
+// readLine reads a line byte by byte, so that the following input is left to the next reads
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// answer gets the answer to q, shown by prompt, read by read, checked by check and then by q.Validate.
+// Invalid input is asked again, invalid prepared answers fail.
+func (p *Prompter) answer(q Question, prompt string, read func() (string, error), check func(string) error) (string, error) {
+	validate := func(s string) error {
+		if err := check(s); err != nil {
+			return err
+		}
+		if q.Validate != nil {
+			return q.Validate(s)
+		}
+		return nil
+	}
+	fail := func(err error) (string, error) {
+		if q.Name != "" {
+			return "", fmt.Errorf("%s: %w", q.Name, err)
+		}
+		return "", err
+	}
+	if p.Answers != nil && q.Name != "" {
+		if s, ok := p.Answers(q.Name); ok {
+			if err := validate(s); err != nil {
+				return fail(err)
+			}
+			return s, nil
+		}
+	}
+	if p.NonInteractive {
+		if q.Default == "" {
+			return fail(ErrNoAnswer)
+		}
+		if err := validate(q.Default); err != nil {
+			return fail(err)
+		}
+		return q.Default, nil
+	}
+	for {
+		fmt.Fprint(p.out(), prompt)
+		s, err := read()
+		eof := err == io.EOF
+		if eof {
+			// no more input, taken as an empty line once
+			fmt.Fprintln(p.out())
+		} else if err != nil {
+			return fail(err)
+		}
+		if strings.TrimSpace(s) == "" {
+			if eof && q.Default == "" {
+				return fail(ErrNoAnswer)
+			}
+			s = q.Default
+		}
+		if err = validate(s); err == nil {
+			return s, nil
+		} else if eof {
+			return fail(err)
+		}
+		fmt.Fprintln(p.out(), err)
+	}
+}
+
+// withDefault appends the default to the prompt
+func withDefault(prompt, def string) string {
+	if def == "" {
+		return prompt
+	}
+	return prompt + "[" + def + "] "
+}
+
+// Ask reads a line of input, an empty line is a valid answer unless rejected by Validate
+func (p *Prompter) Ask(q Question) (string, error) {
+	return p.answer(q, withDefault(q.Prompt, q.Default), p.readLine, func(string) error {
+		return nil
+	})
+}
+
+// Confirm asks a yes/no question, Default is "y" or "n"
+func (p *Prompter) Confirm(q Question) (bool, error) {
+	choices := "[y/n] "
+	switch strings.ToLower(q.Default) {
+	case "y", "yes":
+		choices = "[Y/n] "
+	case "n", "no":
+		choices = "[y/N] "
+	}
+	s, err := p.answer(q, q.Prompt+choices, p.readLine, func(s string) error {
+		if _, ok := parseYesNo(s); !ok {
+			return errors.New("please answer y or n")
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	yes, _ := parseYesNo(s)
+	return yes, nil
+}
+
+func parseYesNo(s string) (yes, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes", "true", "1":
+		return true, true
+	case "n", "no", "false", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// Select asks for one of the options, answered by its number or its text.
+// Default is the text of an option.
+func (p *Prompter) Select(q Question, options []string) (string, error) {
+	p.listOptions(q, options)
+	s, err := p.answer(q, withDefault(fmt.Sprintf("Choose 1-%d: ", len(options)), q.Default), p.readLine, func(s string) error {
+		_, err := selectOption(s, options)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return selectOption(s, options)
+}
+
+// MultiSelect asks for any of the options, answered by their numbers or texts separated by commas.
+// Default lists the texts of the options the same way.
+func (p *Prompter) MultiSelect(q Question, options []string) ([]string, error) {
+	p.listOptions(q, options)
+	s, err := p.answer(q, withDefault(fmt.Sprintf("Choose 1-%d, separated by commas: ", len(options)), q.Default), p.readLine, func(s string) error {
+		_, err := selectOptions(s, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectOptions(s, options)
+}
+
+// listOptions shows the prompt and the numbered options, unless answered without asking
+func (p *Prompter) listOptions(q Question, options []string) {
+	if p.NonInteractive {
+		return
+	}
+	if p.Answers != nil && q.Name != "" {
+		if _, ok := p.Answers(q.Name); ok {
+			return
+		}
+	}
+	fmt.Fprintln(p.out(), strings.TrimRight(q.Prompt, " "))
+	for i, o := range options {
+		fmt.Fprintf(p.out(), "  %d) %s\n", i+1, o)
+	}
+}
+
+func selectOption(s string, options []string) (string, error) {
+	s = strings.TrimSpace(s)
+	if i, err := strconv.Atoi(s); err == nil && i >= 1 && i <= len(options) {
+		return options[i-1], nil
+	}
+	for _, o := range options {
+		if strings.EqualFold(o, s) {
+			return o, nil
+		}
+	}
+	return "", fmt.Errorf("invalid choice %q", s)
+}
+
+func selectOptions(s string, options []string) (selected []string, err error) {
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		o, err := selectOption(f, options)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[o] {
+			seen[o] = true
+			selected = append(selected, o)
+		}
+	}
+	return
+}
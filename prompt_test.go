@@ -0,0 +1,112 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestPrompterAsk(t *testing.T) {
+	var out bytes.Buffer
+	p := &Prompter{In: strings.NewReader("John Smith\n\nshort\nlong enough\r\n"), Out: &out}
+	name, err := p.Ask(Question{Prompt: "Name: "})
+	assert.NoError(t, err)
+	assert.Equal(t, "John Smith", name, "The whole line should be read")
+
+	city, err := p.Ask(Question{Prompt: "City: ", Default: "Paris"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Paris", city, "Empty input should take the default")
+
+	pw, err := p.Ask(Question{Prompt: "Password: ", Validate: func(s string) error {
+		if len(s) < 6 {
+			return errors.New("too short")
+		}
+		return nil
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "long enough", pw, "Invalid input should be asked again")
+	assert.Equal(t, "Name: City: [Paris] Password: too short\nPassword: ", out.String(), "Input should not be echoed")
+
+	_, err = p.Ask(Question{Name: "more", Prompt: "More: "})
+	assert.True(t, errors.Is(err, ErrNoAnswer), err)
+	s, err := p.Ask(Question{Prompt: "More: ", Default: "none"})
+	assert.NoError(t, err)
+	assert.Equal(t, "none", s, "The end of input should take the default")
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	var out bytes.Buffer
+	p := &Prompter{In: strings.NewReader("maybe\nYes\n\nn\n"), Out: &out}
+	yes, err := p.Confirm(Question{Prompt: "Deploy? "})
+	assert.NoError(t, err)
+	assert.True(t, yes)
+	yes, err = p.Confirm(Question{Prompt: "Deploy? ", Default: "n"})
+	assert.NoError(t, err)
+	assert.False(t, yes)
+	yes, err = p.Confirm(Question{Prompt: "Deploy? ", Default: "y"})
+	assert.NoError(t, err)
+	assert.False(t, yes)
+	assert.Equal(t, "Deploy? [y/n] please answer y or n\nDeploy? [y/n] Deploy? [y/N] Deploy? [Y/n] ", out.String())
+}
+
+func TestPrompterSelect(t *testing.T) {
+	var out bytes.Buffer
+	p := &Prompter{In: strings.NewReader("4\nGreen\n\n1, blue,1\n"), Out: &out}
+	options := []string{"red", "green", "blue"}
+	s, err := p.Select(Question{Prompt: "Color:"}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, "green", s)
+	assert.Equal(t, "Color:\n  1) red\n  2) green\n  3) blue\nChoose 1-3: invalid choice \"4\"\nChoose 1-3: ", out.String())
+
+	s, err = p.Select(Question{Prompt: "Color:", Default: "blue"}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, "blue", s)
+
+	many, err := p.MultiSelect(Question{Prompt: "Colors:"}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"red", "blue"}, many)
+}
+
+func TestPrompterAnswers(t *testing.T) {
+	Env.Set("ANSWER_DEPLOY_TARGET=staging", "ANSWER_CONFIRM=yes")
+	defer Env.Unset("ANSWER_DEPLOY_TARGET", "ANSWER_CONFIRM")
+	var out bytes.Buffer
+	p := &Prompter{In: strings.NewReader("unused\n"), Out: &out, Answers: EnvAnswers("ANSWER_"), NonInteractive: true}
+	s, err := p.Select(Question{Name: "deploy target", Prompt: "Target:"}, []string{"staging", "production"})
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", s)
+	yes, err := p.Confirm(Question{Name: "confirm"})
+	assert.NoError(t, err)
+	assert.True(t, yes)
+	s, err = p.Ask(Question{Name: "region", Default: "eu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eu", s, "Unanswered questions should take the default")
+	_, err = p.Ask(Question{Name: "user"})
+	assert.True(t, errors.Is(err, ErrNoAnswer))
+	assert.Equal(t, "user: no answer", err.Error())
+	_, err = p.Select(Question{Name: "confirm"}, []string{"a"})
+	assert.Error(t, err, "Invalid answers should fail")
+	assert.Equal(t, "", out.String(), "Nothing should be shown")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "answers.env")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("USER='ann lee'\n"), 0644))
+	answers, err := FileAnswers(path)
+	assert.NoError(t, err)
+	p = &Prompter{In: strings.NewReader("bob\n"), Out: &out, Answers: answers}
+	s, err = p.Ask(Question{Name: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ann lee", s)
+	s, err = p.Ask(Question{Name: "host"})
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", s, "Interactive prompters should ask the questions without answer")
+
+	_, err = FileAnswers(filepath.Join(dir, "missing.env"))
+	assert.True(t, errors.Is(err, os.ErrNotExist), err)
+}
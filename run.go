@@ -7,8 +7,6 @@ import (
 	"fmt"
 	"bytes"
 	"io"
-	"log"
-	"io/ioutil"
 	"syscall"
 )
 
@@ -30,10 +28,14 @@ const (
 // Shell defines a shell command Runnable object, which evaluates sh/bash command line. 
 // Use backquote for multiline commands.
 // To specify a shell, insert shell name as the first string argument
-// To run as shell script, use run.Call("sh/bash script.sh")
+// To run as shell script, use run.Script("script.sh")
 func Shell(c ...string) Runnable{
 	return shell(c, nil)
 }
+// Script defines a Runnable object, which runs the script file with the shell and the positional arguments
+func Script(path string, args ...string) Runnable{
+	return script(path, args, nil)
+}
 // Call defines a system call Runnable object, which calls the command with arguments
 func Call(c string) Runnable{
 	return call(c, nil)
@@ -57,12 +59,29 @@ type Runnable interface{
 	Call(string) Runnable
 	Start(string) Runnable
 	Shell(...string) Runnable
+	Script(string, ...string) Runnable
 
 	With(...string) Runnable
+	WithSecret(...string) Runnable
+	WithEnvFile(string) Runnable
+	Isolate(...string) Runnable
+	Deny(...string) Runnable
 	Pipe(int, *bytes.Buffer) Runnable
+	Tee(int, ...io.Writer) Runnable
+	CaptureOutput(*Output) Runnable
+	Scrub() Runnable
+	Lines(LineOutput) Runnable
+	Tty() Runnable
+	Expect(...ExpectStep) Runnable
+	CaptureEnv(...*EnvSet) Runnable
+	WithHooks(Hooks) Runnable
 
 	At(string) Runnable
 	In(string) Runnable
+	Using(ShellConfig) Runnable
+	Parallel(...Runnable) Runnable
+	Sources(...string) Runnable
+	Targets(...string) Runnable
 }
 
 // runner is Runnable's underlying implementation
@@ -78,6 +97,62 @@ func (r runner) Pipe(p int, b *bytes.Buffer) Runnable{
 	return pipe(p,b, r)
 }
 
+// Tee implements Runnable interface, the output is written to the sinks as well
+func (r runner) Tee(p int, sinks ...io.Writer) Runnable{
+	return tee(p, sinks, r)
+}
+
+// CaptureOutput implements Runnable interface, stdout and stderr are recorded in order into the Output
+func (r runner) CaptureOutput(o *Output) Runnable{
+	return captureOutput(o, r)
+}
+
+// Scrub implements Runnable interface, secret values are replaced in the output of the commands
+func (r runner) Scrub() Runnable{
+	return scrub(r)
+}
+
+// CaptureEnv implements Runnable interface, the variables left by shell scripts
+// are merged into Env or the given set
+func (r runner) CaptureEnv(into ...*EnvSet) Runnable{
+	return captureEnv(into, r)
+}
+
+// Parallel implements Runnable interface
+func (r runner) Parallel(rs ...Runnable) Runnable{
+	return parallel(rs, r)
+}
+
+// Sources implements Runnable interface, the preceding chain is skipped if its targets are up to date
+func (r runner) Sources(globs ...string) Runnable{
+	return newGuard(r, globs, nil)
+}
+
+// Targets implements Runnable interface, the preceding chain is skipped if the targets are up to date
+func (r runner) Targets(globs ...string) Runnable{
+	return newGuard(r, nil, globs)
+}
+
+// WithHooks implements Runnable interface, the hooks are called for the commands of the chain
+func (r runner) WithHooks(h Hooks) Runnable{
+	return withHooks(h, r)
+}
+
+// Lines implements Runnable interface, the output of the commands is written line by line with a prefix
+func (r runner) Lines(o LineOutput) Runnable{
+	return lines(o, r)
+}
+
+// Tty implements Runnable interface, the commands run under a pseudo-terminal
+func (r runner) Tty() Runnable{
+	return tty(r)
+}
+
+// Expect implements Runnable interface, the commands get their input from the steps
+func (r runner) Expect(steps ...ExpectStep) Runnable{
+	return expect(steps, r)
+}
+
 // In implements Runnable interface
 func (r runner) In(p string) Runnable{
 	return in(p, r)
@@ -87,10 +162,32 @@ func (r runner) In(p string) Runnable{
 func (r runner) With(o ...string) Runnable{
 	return with(o, r)
 }
+// WithSecret implements Runnable interface, the values are redacted from logs and error messages
+func (r runner) WithSecret(o ...string) Runnable{
+	return withSecret(o, r)
+}
+// WithEnvFile implements Runnable interface
+func (r runner) WithEnvFile(p string) Runnable{
+	return withEnvFile(p, r)
+}
+// Isolate implements Runnable interface,
+// child processes inherit only the process variables matching the allowed patterns
+func (r runner) Isolate(a ...string) Runnable{
+	return isolate(a, r)
+}
+// Deny implements Runnable interface,
+// child processes do not inherit the process variables matching the patterns
+func (r runner) Deny(p ...string) Runnable{
+	return deny(p, r)
+}
 // Shell implements Runnable interface
 func (r runner) Shell(c ...string) Runnable{
 	return shell(c, r)
 }
+// Script implements Runnable interface
+func (r runner) Script(p string, a ...string) Runnable{
+	return script(p, a, r)
+}
 // Call implements Runnable interface
 func (r runner) Call(c string) Runnable{
 	return call(c, r)
@@ -105,20 +202,25 @@ func (r runner) At(p string) Runnable{
 	return at(p,r)
 }
 
+// Using implements Runnable interface
+func (r runner) Using(c ShellConfig) Runnable{
+	return using(c, r)
+}
 
-var logger = log.New(ioutil.Discard, "[run] ", log.LstdFlags)
 
 func with(vars []string, run Runnable) Runnable {
 	return runner(func() error {
-		// Naaive implementation, need cmdean up
 		env := Env
-		Env = Env.combine(vars)
+		defer func(){
+			Env = env
+		}()
+		Env = Env.Layer(WithLayer)
+		if err := Env.Set(vars...); err != nil {
+			return err
+		}
 		if run !=nil {
-			if err :=  run.Run(); err!=nil{
-				return err
-			}
+			return run.Run()
 		}
-		Env = env
 		return nil
 	})
 }
@@ -131,6 +233,7 @@ func at(path string, run Runnable) Runnable {
 			workingDir = pwd
 		}()
 		workingDir= path
+		logger.Log(EventDirChanged, "dir", path, "chdir", false)
 		if run!=nil{
 			return run.Run()
 		}else{
@@ -185,7 +288,10 @@ func pipe(pipe int, buf *bytes.Buffer, run Runnable) Runnable {
 				
 				if run!=nil{
 					if err := run.Run();  err != nil {
-						return fmt.Errorf("Error when running: %v\n", err)
+						// the output written before the error is copied before returning
+						w.Close()
+						<-ec
+						return fmt.Errorf("Error when running: %w\n", err)
 					}
 				}
 
@@ -250,6 +356,7 @@ func in(path string, run Runnable) Runnable {
 		if err := os.Chdir(path); err != nil {
 			return err
 		}
+		logger.Log(EventDirChanged, "dir", path, "chdir", true)
 
 		if run!=nil{
 			return run.Run()
@@ -293,41 +400,6 @@ func start(command string, run Runnable) Runnable {
 	})
 }
 
-func shell(command []string, run Runnable) Runnable {
-
-	return runner(func() error{
-		if run!=nil{
-			if err:=run.Run(); err!=nil{
-				return err
-			}
-		}
-		if len(command)==2{
-			return (&syncApp{
-				app{
-					bin: command[0],
-					arg: []string{"-c", command[1]},
-					dir: workingDir ,
-					cmd: strings.Join(command, " "),
-				},
-			}).Run()
-		}else if len(command)==1{
-			return (&syncApp{
-				app{
-					// default shell
-					bin: "sh",
-					arg: []string{"-c", command[0]},
-					dir: workingDir ,
-					cmd: command[0],
-				},
-			}).Run()
-		}else{
-			return fmt.Errorf("Shell command options not valid!")
-		}
-
-	})
-
-}
-
 func call(command string, run Runnable) Runnable {
 
 	return runner(func() error{
@@ -357,7 +429,7 @@ func call(command string, run Runnable) Runnable {
 			
 			err := prog.Run()
 			if err != nil {
-				return fmt.Errorf(err.Error()+"\nline=%d", i)
+				return fmt.Errorf("%w\nline=%d", err, i)
 			}
 		}
 		return nil 
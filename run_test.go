@@ -13,7 +13,7 @@ import (
 
 var cat = "cat"
 func init() {
-	logger.SetOutput(os.Stdout)
+	SetLogger(NewTextLogger(os.Stdout))
 	if runtime.GOOS == "windows" {
 		cat = "type"
 	}
@@ -141,9 +141,9 @@ func TestEnvOperation(t *testing.T) {
 		assert.Equal(t, nil,status)
 	}*/
 	os.Setenv("TEST_RUN_ENV", "fubar")
-	Env = makeEnvMap(os.Environ(), true)
+	Env = newGlobalEnv()
 
-	assert.Equal(t, "fubar", (*Env)["TEST_RUN_ENV"], "set/export env failed")	
+	assert.Equal(t, "fubar", Env.Get("TEST_RUN_ENV"), "set/export env failed")	
 	output:= bytes.NewBuffer(nil)
 	if runtime.GOOS == "windows" {
 		Call(`FOO=bar BAH=baz cmd /C 'echo %TEST_RUN_ENV% %FOO%'`).Pipe(Stdout, output).Run()
@@ -0,0 +1,204 @@
+// Package runtest provides assertions on the outcome of go-run chains, for the tests of build scripts.
+//
+//	func TestBuild(t *testing.T) {
+//		runtest.Run(t, run.Call("go build ./...")).Success().StderrEquals("")
+//		runtest.Run(t, run.Shell("./release.sh --dry-run")).
+//			ExitCode(0).
+//			StdoutContains("tagging").
+//			StdoutMatches(`v\d+\.\d+\.\d+`).
+//			StdoutGolden("release.golden")
+//	}
+//
+// Golden files are read from GoldenDir, run the tests with -update to write them.
+package runtest
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	run "github.com/Fiery/go-run"
+	"github.com/Fiery/testify/assert"
+)
+
+// Update rewrites the golden files with the actual output, set by the -update flag.
+// Tests using runtest share the flag rather than defining their own.
+var Update bool
+
+func init() {
+	// an -update flag defined before, by a package initialized earlier, is used instead
+	if flag.Lookup("update") == nil {
+		flag.BoolVar(&Update, "update", false, "update the golden files of runtest")
+	}
+}
+
+// updating reports whether the golden files are written, by Update or an -update flag defined elsewhere
+func updating() bool {
+	f := flag.Lookup("update")
+	return Update || f != nil && f.Value.String() == "true"
+}
+
+// GoldenDir is the directory of the golden files
+var GoldenDir = "testdata"
+
+// Result is the outcome of a chain run by Run
+type Result struct {
+	t testing.TB
+	// Err is the error returned by the chain
+	Err error
+	// Code is the exit code of the failed command, 0 on success and -1 if the chain failed otherwise
+	Code int
+	// Output holds the stdout and stderr lines in order
+	Output run.Output
+}
+
+// Run runs the chain, capturing its output
+func Run(t testing.TB, r run.Runnable) *Result {
+	t.Helper()
+	res := &Result{t: t}
+	res.Err = r.CaptureOutput(&res.Output).Run()
+	var exit *exec.ExitError
+	switch {
+	case res.Err == nil:
+	case errors.As(res.Err, &exit):
+		res.Code = exit.ExitCode()
+	default:
+		res.Code = -1
+	}
+	return res
+}
+
+// Stdout returns the output of the chain to stdout
+func (r *Result) Stdout() string {
+	return r.Output.Stdout()
+}
+
+// Stderr returns the output of the chain to stderr
+func (r *Result) Stderr() string {
+	return r.Output.Stderr()
+}
+
+// Success asserts the chain succeeded
+func (r *Result) Success() *Result {
+	r.t.Helper()
+	assert.NoError(r.t, r.Err, "stderr:\n%s", r.Stderr())
+	return r
+}
+
+// Failure asserts the chain failed
+func (r *Result) Failure() *Result {
+	r.t.Helper()
+	assert.Error(r.t, r.Err, "the chain should fail")
+	return r
+}
+
+// ExitCode asserts the exit code of the chain
+func (r *Result) ExitCode(code int) *Result {
+	r.t.Helper()
+	assert.Equal(r.t, code, r.Code, "exit code, error: %v", r.Err)
+	return r
+}
+
+// StdoutContains asserts stdout contains each of the strings
+func (r *Result) StdoutContains(subs ...string) *Result {
+	r.t.Helper()
+	return r.contains("stdout", r.Stdout(), subs)
+}
+
+// StderrContains asserts stderr contains each of the strings
+func (r *Result) StderrContains(subs ...string) *Result {
+	r.t.Helper()
+	return r.contains("stderr", r.Stderr(), subs)
+}
+
+func (r *Result) contains(stream, out string, subs []string) *Result {
+	r.t.Helper()
+	for _, sub := range subs {
+		if !strings.Contains(out, sub) {
+			r.t.Errorf("%s does not contain %q:\n%s", stream, sub, out)
+		}
+	}
+	return r
+}
+
+// StdoutMatches asserts stdout matches each of the regular expressions
+func (r *Result) StdoutMatches(patterns ...string) *Result {
+	r.t.Helper()
+	return r.matches("stdout", r.Stdout(), patterns)
+}
+
+// StderrMatches asserts stderr matches each of the regular expressions
+func (r *Result) StderrMatches(patterns ...string) *Result {
+	r.t.Helper()
+	return r.matches("stderr", r.Stderr(), patterns)
+}
+
+func (r *Result) matches(stream, out string, patterns []string) *Result {
+	r.t.Helper()
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			r.t.Errorf("invalid pattern %q: %v", p, err)
+			continue
+		}
+		if !re.MatchString(out) {
+			r.t.Errorf("%s does not match %q:\n%s", stream, p, out)
+		}
+	}
+	return r
+}
+
+// StdoutEquals asserts the whole stdout
+func (r *Result) StdoutEquals(expected string) *Result {
+	r.t.Helper()
+	assert.Equal(r.t, expected, r.Stdout(), "stdout")
+	return r
+}
+
+// StderrEquals asserts the whole stderr
+func (r *Result) StderrEquals(expected string) *Result {
+	r.t.Helper()
+	assert.Equal(r.t, expected, r.Stderr(), "stderr")
+	return r
+}
+
+// StdoutGolden asserts stdout equals the golden file
+func (r *Result) StdoutGolden(name string) *Result {
+	r.t.Helper()
+	Golden(r.t, name, r.Stdout())
+	return r
+}
+
+// StderrGolden asserts stderr equals the golden file
+func (r *Result) StderrGolden(name string) *Result {
+	r.t.Helper()
+	Golden(r.t, name, r.Stderr())
+	return r
+}
+
+// Golden asserts actual equals the content of the golden file name in GoldenDir.
+// With Update set the file is written instead.
+func Golden(t testing.TB, name, actual string) {
+	t.Helper()
+	path := filepath.Join(GoldenDir, name)
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file, run with -update to create it: %v", err)
+	}
+	assert.Equal(t, string(expected), actual, "golden file %s", path)
+}
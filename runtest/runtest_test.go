@@ -0,0 +1,105 @@
+package runtest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	run "github.com/Fiery/go-run"
+	"github.com/Fiery/testify/assert"
+)
+
+// update is defined before the init of runtest, which uses it then
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// recorder is a testing.TB recording the failures instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func (r *recorder) Fatal(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+	r.fatal = true
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	Run(t, run.Shell(`echo hello; echo world; echo warning >&2`)).
+		Success().
+		ExitCode(0).
+		StdoutContains("hello", "world").
+		StdoutMatches(`^hello\n`, `w.rld`).
+		StderrEquals("warning\n").
+		StdoutGolden("hello.golden")
+
+	res := Run(t, run.Shell(`echo failed >&2; exit 3`)).Failure().ExitCode(3).StderrContains("failed").StdoutEquals("")
+	assert.Equal(t, "failed\n", res.Stderr())
+
+	res = Run(t, run.Call("doesnotexist"))
+	assert.Equal(t, -1, res.Code, "Errors other than exit codes should be -1")
+}
+
+func TestRunFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	rec := &recorder{TB: t}
+	Run(rec, run.Shell(`echo out; exit 1`)).
+		Success().
+		ExitCode(0).
+		StdoutContains("out", "missing").
+		StdoutMatches(`^in`, `(`).
+		StderrMatches(`.`).
+		StdoutGolden("hello.golden")
+	assert.Equal(t, 7, len(rec.errors), rec.errors)
+	assert.False(t, rec.fatal)
+
+	rec = &recorder{TB: t}
+	Run(rec, run.Shell(`true`)).Failure().StderrContains("x").StdoutGolden("missing.golden")
+	assert.Equal(t, 3, len(rec.errors), rec.errors)
+	assert.True(t, rec.fatal, "Missing golden files should be fatal")
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	dir, old := t.TempDir(), GoldenDir
+	GoldenDir, Update = dir, true
+	defer func() {
+		GoldenDir, Update = old, false
+	}()
+	Golden(t, "sub/out.golden", "updated\n")
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sub", "out.golden"))
+	assert.NoError(t, err)
+	assert.Equal(t, "updated\n", string(b))
+
+	Update = false
+	Golden(t, "sub/out.golden", "updated\n")
+}
+
+func TestUpdateFlag(t *testing.T) {
+	f := flag.Lookup("update")
+	if assert.NotNil(t, f) {
+		assert.NoError(t, f.Value.Set("true"))
+		assert.True(t, *update)
+		assert.True(t, updating(), "An -update flag defined before runtest should be used")
+		assert.NoError(t, f.Value.Set("false"))
+	}
+	assert.False(t, updating())
+}
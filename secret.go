@@ -0,0 +1,168 @@
+package run
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in logs, error messages and scrubbed output
+const Redacted = "***"
+
+// scrubOutput enables scrubbing of secret values from the output of child processes
+var scrubOutput bool
+
+// SetSecret works like Set and marks the variables as secret,
+// so that their values are shown as Redacted in logs and error messages
+func (e *EnvSet) SetSecret(set ...string) (err error) {
+	for _, kv := range set {
+		if serr := e.Set(kv); serr != nil {
+			if err == nil {
+				err = serr
+			}
+			continue
+		}
+		key, _, _ := parseAssignment(kv)
+		if e.secret == nil {
+			e.secret = make(map[string]bool)
+		}
+		e.secret[key] = true
+	}
+	return
+}
+
+// IsSecret reports whether the visible value of key is secret
+func (e *EnvSet) IsSecret(key string) bool {
+	for s := e; s != nil && !s.process; s = s.parent {
+		if _, ok := s.vals[key]; ok {
+			return s.secret[key]
+		}
+		if s.unset[key] {
+			return false
+		}
+	}
+	return false
+}
+
+// secrets returns the visible secret values, longest first
+func (e *EnvSet) secrets() (vals []string) {
+	for _, key := range e.Keys() {
+		if v := e.Get(key); v != "" && e.IsSecret(key) {
+			vals = append(vals, v)
+		}
+	}
+	sort.Slice(vals, func(i, j int) bool {
+		return len(vals[i]) > len(vals[j])
+	})
+	return
+}
+
+// redact replaces the secret values of Env in s
+func redact(s string) string {
+	return replaceSecrets(s, Env.secrets())
+}
+
+func replaceSecrets(s string, secrets []string) string {
+	for _, v := range secrets {
+		s = strings.Replace(s, v, Redacted, -1)
+	}
+	return s
+}
+
+// redactedError hides secret values in the message of the wrapped error
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+func (e *redactedError) Error() string {
+	return replaceSecrets(e.err.Error(), e.secrets)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps err so that its message does not expose the current secrets,
+// even after the chain that defined them finished
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if secrets := Env.secrets(); len(secrets) > 0 {
+		return &redactedError{err, secrets}
+	}
+	return err
+}
+
+// scrubWriter replaces secret values in the output written through it.
+// Output is buffered per line so that values split across writes are found.
+type scrubWriter struct {
+	sync.Mutex
+	w       io.Writer
+	secrets []string
+	buf     []byte
+}
+
+func (s *scrubWriter) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.buf = append(s.buf, p...)
+	if i := bytes.LastIndexByte(s.buf, '\n'); i >= 0 {
+		line := s.buf[:i+1]
+		if _, err := io.WriteString(s.w, s.scrub(string(line))); err != nil {
+			return 0, err
+		}
+		s.buf = append(s.buf[:0], s.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Close writes the pending incomplete line
+func (s *scrubWriter) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(s.w, s.scrub(string(s.buf)))
+	s.buf = s.buf[:0]
+	return err
+}
+
+func (s *scrubWriter) scrub(text string) string {
+	return replaceSecrets(text, s.secrets)
+}
+
+func withSecret(vars []string, run Runnable) Runnable {
+	return runner(func() error {
+		env := Env
+		defer func() {
+			Env = env
+		}()
+		Env = Env.Layer(WithLayer)
+		if err := Env.SetSecret(vars...); err != nil {
+			return err
+		}
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
+
+func scrub(run Runnable) Runnable {
+	return runner(func() error {
+		old := scrubOutput
+		defer func() {
+			scrubOutput = old
+		}()
+		scrubOutput = true
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestSetSecret(t *testing.T) {
+	env, _ := NewEnv("USER=run")
+	assert.NoError(t, env.SetSecret("TOKEN=s3cr3t", "PASSWORD=hunter2"))
+	assert.Equal(t, "s3cr3t", env.Get("TOKEN"), "Secret values should be available")
+	assert.True(t, env.IsSecret("TOKEN"))
+	assert.False(t, env.IsSecret("USER"))
+	assert.Equal(t, "USER=run TOKEN=*** PASSWORD=***", env.String())
+
+	child := env.Layer(WithLayer)
+	assert.True(t, child.IsSecret("PASSWORD"), "Secrets should be visible in child scopes")
+	child.Set("PASSWORD=public")
+	assert.False(t, child.IsSecret("PASSWORD"), "Overriding value should not be secret")
+	assert.Equal(t, []string{"s3cr3t"}, child.secrets())
+
+	assert.Error(t, env.SetSecret("NOVALUE"))
+
+	merged, _ := NewEnv("TOKEN=public")
+	merged.Merge(child)
+	assert.True(t, merged.IsSecret("TOKEN"), "Merged secrets should stay secret")
+	assert.False(t, merged.IsSecret("PASSWORD"), "Merged plain values should stay plain")
+	assert.Equal(t, "TOKEN=*** USER=run PASSWORD=public", merged.String())
+}
+
+func TestSecretRedaction(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var logs bytes.Buffer
+	old := logger
+	SetLogger(NewTextLogger(&logs))
+	defer SetLogger(old)
+
+	err := Call("$TOKEN --version").WithSecret("TOKEN=./s3cr3t").Run()
+	if assert.Error(t, err) {
+		assert.False(t, strings.Contains(err.Error(), "s3cr3t"), "Error should not expose secrets: "+err.Error())
+		assert.True(t, strings.Contains(err.Error(), Redacted))
+	}
+
+	err = Call("false").WithSecret("TOKEN=s3cr3t").Run()
+	var exitErr *exec.ExitError
+	if assert.True(t, errors.As(err, &exitErr), "Redacted errors should unwrap") {
+		assert.Equal(t, 1, exitErr.ExitCode())
+	}
+
+	logs.Reset()
+	Shell(`true s3cr3t`).WithSecret("TOKEN=s3cr3t").Run()
+	assert.False(t, strings.Contains(logs.String(), "s3cr3t"), "Logs should not expose secrets: "+logs.String())
+	assert.True(t, strings.Contains(logs.String(), "TOKEN=***"))
+}
+
+func TestScrub(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	Shell(`printf "token: $TOKEN\nsplit: s3c"; printf "r3t"`).WithSecret("TOKEN=s3cr3t").Scrub().Pipe(Stdout, &output).Run()
+	assert.Equal(t, "token: ***\nsplit: ***", output.String())
+
+	output.Reset()
+	Shell(`echo -n $TOKEN`).WithSecret("TOKEN=s3cr3t").Pipe(Stdout, &output).Run()
+	assert.Equal(t, "s3cr3t", output.String(), "Output should only be scrubbed on demand")
+}
@@ -0,0 +1,169 @@
+package run
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ShellFlag is a bitmask of shell options enabled before the script starts
+type ShellFlag int
+
+const (
+	// Errexit exits on the first failing command (-e)
+	Errexit ShellFlag = 0x01 << iota
+	// Nounset treats expansion of unset variables as an error (-u)
+	Nounset
+	// Xtrace prints each command before executing it (-x)
+	Xtrace
+	// Pipefail makes a pipeline fail if any of its commands fails (-o pipefail).
+	// It is a bash/ksh/zsh option, plain POSIX sh may reject it.
+	Pipefail
+)
+
+// ShellConfig specifies how Shell and Script Runnables launch the shell
+type ShellConfig struct {
+	// Bin is the name or path of the shell binary, "sh" if empty
+	Bin string
+	// Flags are the shell options to enable
+	Flags ShellFlag
+	// Args are passed to the script as positional parameters $1..$n
+	Args []string
+}
+
+// shellConfig is the configuration used by the Runnables currently running
+var shellConfig = ShellConfig{Bin: "sh"}
+
+// options returns the command line switches for the enabled flags
+func (c ShellConfig) options() (opt []string) {
+	if c.Flags&Errexit > 0 {
+		opt = append(opt, "-e")
+	}
+	if c.Flags&Nounset > 0 {
+		opt = append(opt, "-u")
+	}
+	if c.Flags&Xtrace > 0 {
+		opt = append(opt, "-x")
+	}
+	if c.Flags&Pipefail > 0 {
+		opt = append(opt, "-o", "pipefail")
+	}
+	return
+}
+
+// inline returns the arguments to evaluate script with `-c`,
+// the shell name is passed as $0 so that Args start from $1
+func (c ShellConfig) inline(script string) []string {
+	arg := append(c.options(), "-c", script, c.Bin)
+	return append(arg, c.Args...)
+}
+
+// file returns the binary and arguments to run the script file at path.
+// On Windows batch files are run by cmd regardless of the configured shell.
+func (c ShellConfig) file(path string, args []string) (string, []string) {
+	args = append(append([]string(nil), c.Args...), args...)
+	if ext := strings.ToLower(filepath.Ext(path)); runtime.GOOS == "windows" && (ext == ".cmd" || ext == ".bat") {
+		return "cmd", append([]string{"/C", path}, args...)
+	}
+	return c.Bin, append(append(c.options(), path), args...)
+}
+
+func using(conf ShellConfig, run Runnable) Runnable {
+	return runner(func() error {
+		old := shellConfig
+		defer func() {
+			shellConfig = old
+		}()
+		if conf.Bin == "" {
+			conf.Bin = old.Bin
+		}
+		shellConfig = conf
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
+
+func shell(command []string, run Runnable) Runnable {
+
+	return runner(func() error {
+		if run != nil {
+			if err := run.Run(); err != nil {
+				return err
+			}
+		}
+		conf := shellConfig
+		switch len(command) {
+		case 2:
+			conf.Bin = command[0]
+			command = command[1:]
+		case 1:
+		default:
+			return fmt.Errorf("Shell command options not valid!")
+		}
+		if conf.Bin == BuiltinShell {
+			return interpret(conf, command[0])
+		}
+		a := app{
+			bin: conf.Bin,
+			arg: conf.inline(command[0]),
+			dir: workingDir,
+			cmd: command[0],
+		}
+		if capturedEnv != nil {
+			f, trap, err := dumpEnv()
+			if err != nil {
+				return err
+			}
+			a.arg = conf.inline(trap + command[0])
+			return runCaptured(a, f, command[0])
+		}
+		return (&syncApp{a}).Run()
+	})
+
+}
+
+func script(path string, args []string, run Runnable) Runnable {
+
+	return runner(func() error {
+		if run != nil {
+			if err := run.Run(); err != nil {
+				return err
+			}
+		}
+		if shellConfig.Bin == BuiltinShell {
+			return interpretFile(shellConfig, path, args)
+		}
+		bin, arg := shellConfig.file(path, args)
+		a := app{
+			bin: bin,
+			arg: arg,
+			dir: workingDir,
+			cmd: strings.Join(append([]string{path}, args...), " "),
+		}
+		if capturedEnv != nil {
+			// source the script so that its variables are set in the shell that dumps them
+			f, trap, err := dumpEnv()
+			if err != nil {
+				return err
+			}
+			conf := shellConfig
+			conf.Args = append(append([]string(nil), conf.Args...), args...)
+			if !strings.ContainsAny(path, `/\`) {
+				// "." searches PATH for bare names
+				path = "./" + path
+			}
+			a.bin, a.arg = conf.Bin, conf.inline(trap+". "+shellQuote(path))
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(workingDir, path)
+			}
+			src, _ := ioutil.ReadFile(path)
+			return runCaptured(a, f, string(src))
+		}
+		return (&syncApp{a}).Run()
+	})
+
+}
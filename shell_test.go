@@ -0,0 +1,46 @@
+package run
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestShellOptions(t *testing.T) {
+	conf := ShellConfig{Bin: "bash", Flags: Errexit | Pipefail, Args: []string{"foo"}}
+	assert.Equal(t, []string{"-e", "-o", "pipefail", "-c", "echo $1", "bash", "foo"}, conf.inline("echo $1"))
+
+	bin, arg := conf.file("build.sh", []string{"bar"})
+	assert.Equal(t, "bash", bin)
+	assert.Equal(t, []string{"-e", "-o", "pipefail", "build.sh", "foo", "bar"}, arg)
+}
+
+func TestUsing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	Shell(`echo -n $1 $2`).Using(ShellConfig{Bin: "bash", Args: []string{"foo", "bar"}}).Pipe(Stdout, &output).Run()
+	assert.Equal(t, "foo bar", output.String(), "Positional arguments not passed.")
+
+	err := Shell(`false | true`).Using(ShellConfig{Bin: "bash", Flags: Pipefail}).Run()
+	assert.Error(t, err, "Pipefail should have failed the pipeline.")
+
+	var errexit bytes.Buffer
+	err = Shell(`false; echo -n foobar`).Using(ShellConfig{Flags: Errexit}).Pipe(Stdout, &errexit).Run()
+	assert.Error(t, err)
+	assert.Equal(t, "", errexit.String(), "Errexit should have stopped the script.")
+	assert.Equal(t, "sh", shellConfig.Bin, "Using failed to reset shell configuration")
+}
+
+func TestScript(t *testing.T) {
+	var output bytes.Buffer
+	if runtime.GOOS == "windows" {
+		Script("foo.cmd").At("test").Pipe(Stdout, &output).Run()
+	} else {
+		Script("foo.sh").Using(ShellConfig{Bin: "bash"}).At("test").Pipe(Stdout, &output).Run()
+	}
+	assert.Equal(t, "FOOBAR", output.String())
+}
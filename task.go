@@ -0,0 +1,113 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+)
+
+// task is a named Runnable registered with Task
+type task struct {
+	name string
+	deps []string
+	run  Runnable
+}
+
+// taskMap holds the registered tasks by name
+var taskMap = make(map[string]*task)
+
+// Task registers the Runnable under name, to be run by Do after the tasks named in deps.
+// The Runnable may be nil for tasks only grouping their dependencies.
+// Registering a name again replaces the task.
+func Task(name string, deps []string, r Runnable) {
+	taskMap[name] = &task{name, append([]string(nil), deps...), r}
+}
+
+// Do runs the named tasks with all their dependencies, every task at most once.
+// Tasks start as soon as their dependencies succeeded, so independent branches
+// run at the same time, see Parallel. Tasks depending on a failed one are skipped.
+// It reports unknown tasks and dependency cycles before running anything,
+// otherwise the error of the first failing task in dependency order.
+func Do(names ...string) error {
+	order, err := resolveTasks(names)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]chan struct{}, len(order))
+	for _, t := range order {
+		done[t.name] = make(chan struct{})
+	}
+	// failed is only accessed by the branch holding chainLock
+	failed := make(map[string]bool)
+
+	runs := make([]Runnable, len(order))
+	for i, t := range order {
+		t := t
+		runs[i] = runner(func() error {
+			defer close(done[t.name])
+			waitCmd(func() error {
+				for _, dep := range t.deps {
+					<-done[dep]
+				}
+				return nil
+			})
+			for _, dep := range t.deps {
+				if failed[dep] {
+					failed[t.name] = true
+					logger.Log(EventTaskSkipped, "task", t.name, "dependency", dep)
+					return nil
+				}
+			}
+			if t.run == nil {
+				return nil
+			}
+			logger.Log(EventTaskStarted, "task", t.name)
+			taskName = t.name
+			if err := t.run.Run(); err != nil {
+				failed[t.name] = true
+				return fmt.Errorf("task %s: %w", t.name, err)
+			}
+			return nil
+		})
+	}
+	return parallel(runs, nil).Run()
+}
+
+// resolveTasks returns the named tasks and their dependencies, each after its dependencies
+func resolveTasks(names []string) (order []*task, err error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		t, ok := taskMap[name]
+		if !ok {
+			if len(path) > 0 {
+				return fmt.Errorf("unknown task %s, dependency of %s", name, path[len(path)-1])
+			}
+			return fmt.Errorf("unknown task %s", name)
+		}
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("task dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range t.deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, t)
+		return nil
+	}
+	for _, name := range names {
+		if err = visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package run
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestResolveTasks(t *testing.T) {
+	defer func() {
+		taskMap = make(map[string]*task)
+	}()
+	Task("a", []string{"b", "c"}, nil)
+	Task("b", []string{"d"}, nil)
+	Task("c", []string{"d"}, nil)
+	Task("d", nil, nil)
+
+	order, err := resolveTasks([]string{"a", "d"})
+	assert.NoError(t, err)
+	var names []string
+	for _, t := range order {
+		names = append(names, t.name)
+	}
+	assert.Equal(t, []string{"d", "b", "c", "a"}, names)
+
+	Task("d", []string{"a"}, nil)
+	_, err = resolveTasks([]string{"a"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "task dependency cycle: a -> b -> d -> a", err.Error())
+	}
+	assert.Error(t, Do("a"), "Do should report cycles")
+
+	Task("d", []string{"e"}, nil)
+	_, err = resolveTasks([]string{"a"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "unknown task e, dependency of d", err.Error())
+	}
+	assert.Error(t, Do("x"))
+}
+
+func TestDo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	defer func() {
+		taskMap = make(map[string]*task)
+	}()
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "log")
+
+	Task("all", []string{"build", "lint"}, Shell(`echo all >> $LOG`).With("LOG="+log))
+	Task("build", []string{"generate"}, Shell(`sleep 0.2; echo build >> $LOG`).With("LOG="+log))
+	Task("lint", []string{"generate"}, Shell(`sleep 0.2; echo lint >> $LOG`).With("LOG="+log))
+	Task("generate", nil, Shell(`echo generate >> $LOG`).With("LOG="+log))
+
+	begin := time.Now()
+	err = Do("all", "generate")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(begin) < 400*time.Millisecond, "Independent tasks should run at the same time")
+	out, _ := ioutil.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if assert.Equal(t, 4, len(lines), "Tasks should run once") {
+		assert.Equal(t, "generate", lines[0])
+		assert.Equal(t, "all", lines[3])
+	}
+
+	os.Remove(log)
+	Task("generate", nil, Shell(`exit 2`))
+	err = Do("all")
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "task generate: "), err.Error())
+	}
+	_, err = os.Stat(log)
+	assert.True(t, os.IsNotExist(err), "Dependent tasks should be skipped")
+}
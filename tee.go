@@ -0,0 +1,194 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TailBufferLineBytes limits the length of a line kept by a TailBuffer without MaxBytes
+var TailBufferLineBytes = 64 << 10
+
+// TailBuffer is a writer keeping the tail of the output written to it,
+// at most MaxLines lines and MaxBytes bytes. Zero limits keep everything.
+// With a limit, text rewritten after a carriage return, like a progress bar,
+// replaces the line as on a terminal, and lines keep their last TailBufferLineBytes
+// bytes if MaxBytes is not set.
+type TailBuffer struct {
+	MaxLines int
+	MaxBytes int
+
+	mu    sync.Mutex
+	lines []string
+	// size is the number of bytes of lines, newlines included
+	size int
+	// partial is the incomplete last line
+	partial []byte
+}
+
+// NewTailBuffer returns a TailBuffer keeping the last lines
+func NewTailBuffer(lines int) *TailBuffer {
+	return &TailBuffer{MaxLines: lines}
+}
+
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := t.limitLine(t.partial[:i])
+		t.lines = append(t.lines, string(line))
+		t.size += len(line) + 1
+		t.partial = t.partial[i+1:]
+	}
+	t.trim()
+	return len(p), nil
+}
+
+// trim drops the oldest output beyond the limits
+func (t *TailBuffer) trim() {
+	if line := t.limitLine(t.partial); len(line) == 0 {
+		// the reslicing in Write would keep the whole output in the backing array
+		t.partial = nil
+	} else if len(line) < len(t.partial) {
+		t.partial = append([]byte(nil), line...)
+	}
+	count := len(t.lines)
+	if len(t.partial) > 0 {
+		count++
+	}
+	for len(t.lines) > 0 && (t.MaxLines > 0 && count > t.MaxLines || t.MaxBytes > 0 && t.size+len(t.partial) > t.MaxBytes) {
+		t.size -= len(t.lines[0]) + 1
+		t.lines = t.lines[1:]
+		count--
+	}
+}
+
+// limitLine returns the part of the line kept with the limits of t
+func (t *TailBuffer) limitLine(line []byte) []byte {
+	if t.MaxLines <= 0 && t.MaxBytes <= 0 {
+		return line
+	}
+	// a carriage return ending the line may be followed by a newline
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 && i < len(line)-1 {
+		line = line[i+1:]
+	}
+	max := t.MaxBytes
+	if max <= 0 {
+		max = TailBufferLineBytes
+	}
+	if len(line) > max {
+		line = line[len(line)-max:]
+	}
+	return line
+}
+
+// Lines returns the kept lines, the incomplete last line included
+func (t *TailBuffer) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, string(t.partial))
+	}
+	return lines
+}
+
+// String returns the kept output
+func (t *TailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var s strings.Builder
+	for _, l := range t.lines {
+		s.WriteString(l)
+		s.WriteByte('\n')
+	}
+	s.Write(t.partial)
+	return s.String()
+}
+
+// Reset discards the kept output
+func (t *TailBuffer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines, t.size, t.partial = nil, 0, nil
+}
+
+// syncWriter serializes the writes of the teed streams to the sinks
+type syncWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Write(p)
+}
+
+func tee(pipe int, sinks []io.Writer, run Runnable) Runnable {
+	return runner(func() error {
+		if pipe&(Stdout|Stderr) == 0 {
+			return fmt.Errorf("Not valid tee option! %d", pipe)
+		}
+		sink := &syncWriter{w: io.MultiWriter(sinks...)}
+		return redirectOutput(pipe, func(stream int, out *os.File) io.Writer {
+			return io.MultiWriter(out, sink)
+		}, run)
+	})
+}
+
+// redirectOutput runs the Runnable with the streams selected by pipe replaced by pipes,
+// which are copied to the writers returned by to for the stream and its original file
+func redirectOutput(pipe int, to func(stream int, out *os.File) io.Writer, run Runnable) error {
+	var writers []*os.File
+	ec := make(chan error, 2)
+	redirectStream := func(stream int, file **os.File) error {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		writers = append(writers, w)
+		dst := to(stream, *file)
+		*file = w
+		go func() {
+			_, err := io.Copy(dst, r)
+			r.Close()
+			ec <- err
+		}()
+		return nil
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+	var err error
+	if pipe&Stdout > 0 {
+		err = redirectStream(Stdout, &os.Stdout)
+	}
+	if err == nil && pipe&Stderr > 0 {
+		err = redirectStream(Stderr, &os.Stderr)
+	}
+	if err == nil && run != nil {
+		err = run.Run()
+	}
+
+	os.Stdout, os.Stderr = stdout, stderr
+	for _, w := range writers {
+		w.Close()
+	}
+	for range writers {
+		if cerr := <-ec; cerr != nil && err == nil {
+			err = fmt.Errorf("Error when copying stream %v\n", cerr)
+		}
+	}
+	return err
+}
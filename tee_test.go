@@ -0,0 +1,81 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tail := NewTailBuffer(3)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(tail, "line %d\n", i)
+	}
+	tail.Write([]byte("part"))
+	assert.Equal(t, []string{"line 4", "line 5", "part"}, tail.Lines(), "The last lines should be kept")
+	tail.Write([]byte("ial\nnext"))
+	assert.Equal(t, "line 5\npartial\nnext", tail.String())
+
+	tail = &TailBuffer{MaxBytes: 10}
+	tail.Write([]byte("abc\ndefg\nhij\n"))
+	assert.Equal(t, "defg\nhij\n", tail.String(), "Lines beyond the byte limit should be dropped")
+	tail.Write([]byte("0123456789ab"))
+	assert.Equal(t, "23456789ab", tail.String(), "Long lines should keep their tail")
+
+	tail.Reset()
+	assert.Equal(t, "", tail.String())
+	assert.Equal(t, 0, len(tail.Lines()))
+
+	tail = NewTailBuffer(200)
+	for i := 0; i <= 100000; i++ {
+		fmt.Fprintf(tail, "\rdownloading %d%%", i/1000)
+	}
+	assert.Equal(t, []string{"downloading 100%"}, tail.Lines(), "Progress output should replace the line")
+	tail.Write([]byte("\r\ndone\n"))
+	assert.Equal(t, []string{"downloading 100%\r", "done"}, tail.Lines())
+	tail.Reset()
+	tail.Write(bytes.Repeat([]byte("x"), 3*TailBufferLineBytes))
+	tail.Write(bytes.Repeat([]byte("y"), 10))
+	assert.Equal(t, TailBufferLineBytes, len(tail.String()), "Lines without newline should be limited")
+	assert.True(t, strings.HasSuffix(tail.String(), "xyyyyyyyyyy"))
+	tail.Write(append(bytes.Repeat([]byte("z"), 2*TailBufferLineBytes), '\n'))
+	assert.Equal(t, TailBufferLineBytes+1, len(tail.String()), "Complete lines should be limited")
+
+	tail = &TailBuffer{}
+	tail.Write([]byte("a\rb\nc\n"))
+	tail.Write(bytes.Repeat([]byte("x"), 2*TailBufferLineBytes))
+	assert.Equal(t, "a\rb\nc\n", tail.String()[:6], "No limit should keep everything")
+	assert.Equal(t, 6+2*TailBufferLineBytes, len(tail.String()))
+
+	tail = &TailBuffer{}
+	tail.Write([]byte("a\nb\n"))
+	assert.Equal(t, "a\nb\n", tail.String(), "No limit should keep everything")
+}
+
+func TestTee(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var shown, sink bytes.Buffer
+	tail := NewTailBuffer(2)
+	err := Shell(`echo one; echo two; echo three >&2`).Tee(Stdout|Stderr, &sink, tail).Pipe(Stdout, &shown).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", shown.String(), "Output should still be written to the stream")
+	lines := strings.Fields(sink.String())
+	sort.Strings(lines)
+	assert.Equal(t, []string{"one", "three", "two"}, lines, "Both streams should be written to the sinks")
+	assert.Equal(t, 2, len(tail.Lines()))
+
+	shown.Reset()
+	sink.Reset()
+	err = Shell(`echo out; exit 3`).Tee(Stdout, &sink).Pipe(Stdout, &shown).Run()
+	assert.Error(t, err)
+	assert.Equal(t, "out\n", sink.String(), "Output should be captured when the command fails")
+
+	assert.Error(t, Call("true").Tee(Stdin, &sink).Run())
+}
@@ -0,0 +1,3 @@
+export ACTIVATED=yes
+export PATH="/opt/run-sdk/bin:$PATH"
+unset RUN_DEACTIVATE
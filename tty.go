@@ -0,0 +1,25 @@
+package run
+
+// ttyMode runs the commands of the chain under a pseudo-terminal
+var ttyMode bool
+
+// ttyCloser stops the copy from the pseudo-terminal once the process exited
+type ttyCloser func() error
+
+func (c ttyCloser) Close() error {
+	return c()
+}
+
+func tty(run Runnable) Runnable {
+	return runner(func() error {
+		old := ttyMode
+		defer func() {
+			ttyMode = old
+		}()
+		ttyMode = true
+		if run != nil {
+			return run.Run()
+		}
+		return nil
+	})
+}
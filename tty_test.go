@@ -0,0 +1,83 @@
+package run
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Fiery/testify/assert"
+)
+
+func TestTty(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		assert.Error(t, Call("true").Tty().Run(), "Tty should not be supported")
+		return
+	}
+	var output bytes.Buffer
+	err := Shell(`if [ -t 0 ] && [ -t 1 ] && [ -t 2 ]; then echo tty; else echo pipe; fi; echo err >&2`).Tty().Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "tty\r\nerr\r\n", output.String(), "Output should be captured from the terminal")
+
+	output.Reset()
+	err = Shell(`[ -t 1 ] && echo tty || echo pipe`).Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "pipe\n", output.String(), "Tty should not outlive its chain")
+
+	output.Reset()
+	err = Shell(`echo secret`).WithSecret("TOKEN=secret").Scrub().Tty().Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output.String(), "***"), "Output modes should apply to the terminal output")
+}
+
+func TestTtyBackground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var output bytes.Buffer
+	begin := time.Now()
+	err := Shell(`(trap '' HUP; exec sleep 3) & echo hi`).Tty().Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\r\n", output.String())
+	assert.True(t, time.Since(begin) < 2*time.Second, "Background children keeping the terminal should not block the chain")
+}
+
+func TestTtyInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	r, w, err := os.Pipe()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+	defer w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+	}()
+
+	var output bytes.Buffer
+	w.WriteString("before\n")
+	err = Shell(`read line; echo "$line"`).Tty().Pipe(Stdout, &output).Run()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(output.String(), "before\r\n"), "Input should be copied to the terminal", output.String())
+
+	// the copy to the terminal is stopped with the command, the input after it is left to the process
+	w.WriteString("after\n")
+	read := make(chan string, 1)
+	go func() {
+		b := make([]byte, 16)
+		n, _ := r.Read(b)
+		read <- string(b[:n])
+	}()
+	select {
+	case s := <-read:
+		assert.Equal(t, "after\n", s, "Input should not be read after the command exited")
+	case <-time.After(time.Second):
+		t.Error("Input after the command exited was swallowed")
+	}
+}
@@ -0,0 +1,158 @@
+//go:build !windows
+// +build !windows
+
+package run
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// startTty starts cmd with a pseudo-terminal as its standard streams.
+// The terminal output, stdout and stderr together, is copied to the stdout of the app.
+// If stdin is a terminal, it is switched to raw mode and its size changes are passed through.
+func (a *app) startTty(cmd *exec.Cmd) error {
+	stdin, stdout := cmd.Stdin, cmd.Stdout
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	restore := func() {}
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		pty.InheritSize(f, ptmx)
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		go func() {
+			for range resize {
+				pty.InheritSize(f, ptmx)
+			}
+		}()
+		state, err := term.MakeRaw(int(f.Fd()))
+		restore = func() {
+			signal.Stop(resize)
+			close(resize)
+			if err == nil {
+				term.Restore(int(f.Fd()), state)
+			}
+		}
+	}
+
+	stopInput := func() {}
+	if stdin != nil {
+		stopInput = copyInput(ptmx, stdin)
+	}
+	done, active := make(chan struct{}), make(chan struct{}, 1)
+	go func() {
+		// the copy ends with an error once the process and its children closed the terminal
+		defer close(done)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				stdout.Write(buf[:n])
+				select {
+				case active <- struct{}{}:
+				default:
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	a.closers = append([]io.Closer{ttyCloser(func() error {
+		// the process exited, but background children may keep the terminal open:
+		// the output is drained until the terminal is closed or stays quiet for ttyDrain
+		quiet := time.NewTimer(ttyDrain)
+		defer quiet.Stop()
+	drain:
+		for {
+			select {
+			case <-done:
+				break drain
+			case <-active:
+				if !quiet.Stop() {
+					<-quiet.C
+				}
+				quiet.Reset(ttyDrain)
+			case <-quiet.C:
+				break drain
+			}
+		}
+		restore()
+		// closing the terminal ends a pending read of the output copy, if the terminal can be polled
+		err := ptmx.Close()
+		select {
+		case <-done:
+		case <-time.After(ttyDrain):
+		}
+		stopInput()
+		return err
+	})}, a.closers...)
+	return nil
+}
+
+// ttyDrain is how long the output of a terminal may stay quiet once its process exited
+const ttyDrain = 100 * time.Millisecond
+
+// copyInput copies stdin to the terminal until the returned stop is called.
+// A file is only read once poll reports it readable, so the copy can be woken up and no later input is lost,
+// stop waits for it to end. Other readers cannot be interrupted: their copy is abandoned,
+// it ends once the reader returns and the write to the closed terminal fails.
+func copyInput(ptmx *os.File, stdin io.Reader) (stop func()) {
+	f, ok := stdin.(*os.File)
+	var wake, woken *os.File
+	if ok {
+		var err error
+		wake, woken, err = os.Pipe()
+		ok = err == nil
+	}
+	if !ok {
+		go io.Copy(ptmx, stdin)
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fds := []unix.PollFd{
+			{Fd: int32(f.Fd()), Events: unix.POLLIN},
+			{Fd: int32(wake.Fd()), Events: unix.POLLIN},
+		}
+		buf := make([]byte, 32<<10)
+		for {
+			if _, err := unix.Poll(fds, -1); err == unix.EINTR {
+				continue
+			} else if err != nil || fds[1].Revents != 0 {
+				return
+			}
+			if fds[0].Revents == 0 {
+				continue
+			}
+			n, err := f.Read(buf)
+			if n > 0 {
+				if _, err := ptmx.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return func() {
+		// closing the write end wakes up poll
+		woken.Close()
+		<-done
+		wake.Close()
+	}
+}
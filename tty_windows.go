@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package run
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startTty reports pseudo-terminals as unsupported
+func (a *app) startTty(cmd *exec.Cmd) error {
+	return errors.New("Tty is not supported on windows")
+}